@@ -1,13 +1,18 @@
-module gs1200-exporter
+module github.com/robinelfrink/gs1200-exporter
 
 go 1.26.4
 
 require (
 	github.com/prometheus/client_golang v1.23.2
 	github.com/robertkrimen/otto v0.5.1
+	go.yaml.in/yaml/v3 v3.0.4
 )
 
-require github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+require (
+	github.com/kr/text v0.2.0 // indirect
+	github.com/kylelemons/godebug v1.1.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+)
 
 require (
 	github.com/beorn7/perks v1.0.1 // indirect
@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/robinelfrink/gs1200-exporter/pkg/gs1200"
+)
+
+// ManifestFile is the name of the manifest in a capture bundle.
+const ManifestFile = "manifest.json"
+
+// Manifest describes a capture bundle.
+type Manifest struct {
+	Model    string    `json:"model"`
+	Firmware string    `json:"firmware"`
+	Captured time.Time `json:"captured"`
+	// Version of the exporter that made the capture.
+	Version string   `json:"version"`
+	Files   []string `json:"files"`
+	// Number of distinct MAC addresses, IP addresses and serial numbers
+	// that were replaced.
+	Redacted int `json:"redacted"`
+}
+
+// CaptureBundle captures the files of the switch at address for a bug report,
+// and writes them to out as a gzipped tar file. The files are redacted, and
+// put in a directory named after the model, next to a manifest, so the
+// directory can be used as a replay source or test fixture as it is.
+func CaptureBundle(ctx context.Context, address string, password string, out string, version string) (*Manifest, error) {
+	client, err := gs1200.NewClient(address, password)
+	if err != nil {
+		return nil, err
+	}
+	files, err := client.Capture(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Captured: time.Now().UTC().Truncate(time.Second),
+		Version:  version,
+		Files:    slices.Sorted(maps.Keys(files)),
+	}
+	// The model and firmware are read without a parser, as the capture is
+	// likely made because the parser fails.
+	if vars, err := gs1200.ParseLiterals(files["system_data.js"]); err == nil {
+		manifest.Model, _ = vars["model_name"].(string)
+		manifest.Firmware, _ = vars["sys_fmw_ver"].(string)
+	}
+	redactor := &redactor{replaced: map[string]string{}}
+	for _, name := range manifest.Files {
+		files[name] = redactor.redact(files[name])
+	}
+	manifest.Redacted = len(redactor.replaced)
+
+	if err := writeBundle(out, fixtureName(manifest.Model), manifest, files); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// writeBundle writes files and their manifest to a gzipped tar file, in dir.
+func writeBundle(out string, dir string, manifest *Manifest, files map[string]string) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     dir + "/",
+		Mode:     0o755,
+		ModTime:  manifest.Captured,
+	}); err != nil {
+		return err
+	}
+	entries := map[string][]byte{ManifestFile: append(data, '\n')}
+	for name, content := range files {
+		entries[name] = []byte(content)
+	}
+	for _, name := range slices.Sorted(maps.Keys(entries)) {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    path.Join(dir, name),
+			Mode:    0o644,
+			Size:    int64(len(entries[name])),
+			ModTime: manifest.Captured,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entries[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+var nonAlphanumericRE = regexp.MustCompile("[^a-z0-9]+")
+
+// fixtureName names the directory of a capture like the test fixtures, e.g.
+// gs1200-8hp-v2.
+func fixtureName(model string) string {
+	name := strings.Trim(nonAlphanumericRE.ReplaceAllString(strings.ToLower(model), "-"), "-")
+	if name == "" {
+		return "capture"
+	}
+	return name
+}
+
+var (
+	macRE    = regexp.MustCompile(`(?i)\b[0-9a-f]{2}(?:[:-][0-9a-f]{2}){5}\b`)
+	ipRE     = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	serialRE = regexp.MustCompile(`(?i)(\w*(?:serial|_sn)\w*\s*=\s*['"])([^'"]*)`)
+)
+
+// redactor replaces MAC addresses, IP addresses and serial numbers with made
+// up ones. A value gets the same replacement in every file, so the data stays
+// consistent.
+type redactor struct {
+	replaced map[string]string
+	macs     int
+	ips      int
+	serials  int
+}
+
+func (r *redactor) redact(s string) string {
+	s = serialRE.ReplaceAllStringFunc(s, func(match string) string {
+		groups := serialRE.FindStringSubmatch(match)
+		if groups[2] == "" {
+			return match
+		}
+		return groups[1] + r.replace(groups[2], func() string {
+			r.serials++
+			return fmt.Sprintf("S%09d", r.serials)
+		})
+	})
+	s = macRE.ReplaceAllStringFunc(s, func(mac string) string {
+		return r.replace(strings.ToUpper(mac), func() string {
+			r.macs++
+			// A locally administered address.
+			return fmt.Sprintf("02:00:00:00:%02X:%02X", r.macs>>8, r.macs&0xff)
+		})
+	})
+	s = ipRE.ReplaceAllStringFunc(s, func(ip string) string {
+		// Netmasks do not identify anything.
+		if strings.HasPrefix(ip, "255.") || strings.HasPrefix(ip, "0.") {
+			return ip
+		}
+		return r.replace(ip, func() string {
+			r.ips++
+			return fmt.Sprintf("10.0.%d.%d", r.ips>>8, r.ips&0xff)
+		})
+	})
+	return s
+}
+
+// replace returns the replacement of value, made up by next the first time.
+func (r *redactor) replace(value string, next func() string) string {
+	if replacement, ok := r.replaced[value]; ok {
+		return replacement
+	}
+	replacement := next()
+	r.replaced[value] = replacement
+	return replacement
+}
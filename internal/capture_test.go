@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/robinelfrink/gs1200-exporter/internal/samples"
+)
+
+func TestCaptureBundle(t *testing.T) {
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+
+	out := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	manifest, err := CaptureBundle(t.Context(), strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM", out, "test")
+	if err != nil {
+		t.Fatalf("CaptureBundle() error = %v", err)
+	}
+	if manifest.Model != "GS1200-8HP v2" || manifest.Firmware != "V2.00(ABME.3)C0" {
+		t.Errorf("CaptureBundle() model = %v, firmware = %v", manifest.Model, manifest.Firmware)
+	}
+
+	// Unpack the bundle, like a user would.
+	dir := t.TempDir()
+	f, _ := os.Open(out)
+	defer func() {
+		_ = f.Close()
+	}()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("CaptureBundle() wrote no gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("CaptureBundle() wrote no tar: %v", err)
+		}
+		name := filepath.Join(dir, header.Name)
+		if header.Typeflag == tar.TypeDir {
+			_ = os.MkdirAll(name, 0o755)
+			continue
+		}
+		data, _ := io.ReadAll(tr)
+		_ = os.WriteFile(name, data, 0o644)
+	}
+	dir = filepath.Join(dir, samples.Default)
+
+	data, _ := os.ReadFile(filepath.Join(dir, ManifestFile))
+	var got Manifest
+	if err := json.Unmarshal(data, &got); err != nil || strings.Join(got.Files, ",") !=
+		"VLAN_1Q_List_data.js,link_data.js,login.html,poe_data.js,system_data.js" {
+		t.Errorf("CaptureBundle() manifest = %s, error = %v", data, err)
+	}
+	js, _ := os.ReadFile(filepath.Join(dir, "system_data.js"))
+	for _, value := range []string{"BC:CF:4F:FC:5E:A8", "192.168.1.3", "192.168.1.1"} {
+		if strings.Contains(string(js), value) {
+			t.Errorf("CaptureBundle() did not redact %v", value)
+		}
+	}
+	if !strings.Contains(string(js), "'255.255.255.0'") {
+		t.Errorf("CaptureBundle() redacted the netmask")
+	}
+
+	// The bundle replays as the switch.
+	collector, _ := ReplayCollector("replay", dir, DefaultModule)
+	systemData, portData, err := collector.Collect(t.Context(), nil)
+	if err != nil {
+		t.Fatalf("Collector.Collect() error = %v", err)
+	}
+	if systemData.Model != manifest.Model || len(portData) != 8 || systemData.MAC != "02:00:00:00:00:01" {
+		t.Errorf("Collector.Collect() = %v, %d ports, MAC %v", systemData.Model, len(portData), systemData.MAC)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	r := &redactor{replaced: map[string]string{}}
+	got := r.redact("var sys_MAC = 'bc:cf:4f:fc:5e:a8'; var sys_IP = '10.1.2.3'; var sys_serial = 'S123';") +
+		r.redact("var mac = 'BC:CF:4F:FC:5E:A8'; var gw = '10.1.2.1'; var ip = '10.1.2.3';")
+	want := "var sys_MAC = '02:00:00:00:00:01'; var sys_IP = '10.0.0.1'; var sys_serial = 'S000000001';" +
+		"var mac = '02:00:00:00:00:01'; var gw = '10.0.0.2'; var ip = '10.0.0.1';"
+	if got != want {
+		t.Errorf("redactor.redact() = %v, want %v", got, want)
+	}
+	if len(r.replaced) != 4 {
+		t.Errorf("redactor.replaced = %v, want 4 values", r.replaced)
+	}
+}
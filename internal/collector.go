@@ -1,351 +1,321 @@
 package internal
 
 import (
+	"context"
 	"errors"
-	"io"
-	"math/rand"
-	"net/http"
-	"net/http/cookiejar"
-	"net/url"
-	"strconv"
+	"fmt"
+	"os"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/robinelfrink/gs1200-exporter/pkg/gs1200"
 
-	"github.com/robertkrimen/otto"
 	log "github.com/sirupsen/logrus"
 )
 
-var client http.Client
-var vm *otto.Otto
-var systemData SystemData
-var portData []PortData
-
+// Collector scrapes a switch for the exporter. It adds the exporter's policies,
+// like yielding to somebody else and background polling, to a gs1200.Client.
 type Collector struct {
-	address  string
-	password string
+	client       *gs1200.Client
+	module       Module
+	onConflict   string
+	pollInterval time.Duration
+
+	// Results of past scrapes have their own mutex, so they can be read
+	// while a scrape is in progress.
+	mu        sync.Mutex
+	conflicts float64
+	errors    map[errorKey]float64
+	reboots   float64
+	// The last known uptime of the switch.
+	uptime time.Duration
+	// Fields of the switch's data that could not be parsed.
+	parseErrors map[string]float64
+	last        *snapshot
+	lastPoll    *gs1200.Trace
+
+	// Background polling.
+	stop chan struct{}
+	done chan struct{}
 }
 
-type SystemData struct {
-	Max_port      int64
-	model_name    string
-	sys_fmw_ver   string
-	sys_IP        string
-	sys_MAC       string
-	loop          string
-	vlans         []string
-	total_power   int
-	max_led_power int
+// snapshot is the last successfully collected data, served when yielding to
+// somebody else or when polling in the background.
+type snapshot struct {
+	systemData *gs1200.SystemData
+	portData   []gs1200.PortData
+	time       time.Time
 }
 
-type PortStats struct {
-	rx         float64
-	tx         float64
-	port_power float64
+// Scrape is the outcome of scraping a switch, as reported by the exporter.
+type Scrape struct {
+	SystemData *gs1200.SystemData
+	PortData   []gs1200.PortData
+	Err        error
+	// The trace of the scrape, or of the last background poll. Nil if
+	// nothing was polled yet.
+	Trace *gs1200.Trace
+	// When the last successful scrape took place, zero if never.
+	Collected time.Time
+	// Whether the data came from background polling.
+	Polled    bool
+	Conflicts float64
+	Errors    map[errorKey]float64
+	Reboots   float64
+	// Fields that could not be parsed, by field.
+	ParseErrors map[string]float64
 }
 
-type PortData struct {
-	name        string
-	loop_status string
-	portstatus  string
-	speed       int
-	speedUnit   string
-	duplex      string
-	stats       PortStats
-	pvlan       string
-	vlans       []string
+// Module selects which pages, next to the always required system page, are
+// fetched from the switch.
+type Module struct {
+	Pages []string `yaml:"pages"`
 }
 
-func GS1200Collector(address string, password string) (*Collector, error) {
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		log.Error(err)
-		return nil, err
-	}
-	client = http.Client{
-		Jar: jar,
-		Transport: &http.Transport{
-			DisableKeepAlives: true,
-			MaxIdleConns:      5,
-		},
-	}
-
-	collector := &Collector{
-		address:  address,
-		password: password,
-	}
-	return collector, nil
+// DefaultModule fetches all pages.
+var DefaultModule = Module{
+	Pages: gs1200.AllPages,
 }
 
-func (c *Collector) GetValue(name string) otto.Value {
-	value, _ := vm.Get(name)
-	return value
-}
+// What to do when somebody else is logged in to the switch.
+const (
+	// Fail the scrape.
+	ConflictFail = "fail"
+	// Retry logging in, with exponential backoff, until the conflict
+	// timeout passes.
+	ConflictRetry = "retry"
+	// Leave the switch to the other user, and serve the last collected
+	// data.
+	ConflictYield = "yield"
+)
 
-func (c *Collector) GetFloat(name string) float64 {
-	value, _ := c.GetValue(name).ToFloat()
-	return value
-}
+const (
+	DefaultConflictTimeout = 5 * time.Second
+)
 
-func (c *Collector) GetString(name string) string {
-	value, _ := c.GetValue(name).ToString()
-	return value
-}
+// Where the data of the switches comes from.
+const (
+	// The switches themselves.
+	SourceSwitch = "switch"
+	// Prefix of a directory of javascript files captured from a switch,
+	// like dir:/path/to/capture.
+	SourceDirPrefix = "dir:"
+)
 
-func (c *Collector) GetInt(name string) int {
-	value, _ := c.GetValue(name).ToInteger()
-	return int(value)
+// CheckSource returns an error if source is not SourceSwitch, nor an existing
+// directory prefixed by SourceDirPrefix.
+func CheckSource(source string) error {
+	if source == SourceSwitch {
+		return nil
+	}
+	dir, ok := strings.CutPrefix(source, SourceDirPrefix)
+	if !ok {
+		return fmt.Errorf("unknown source %q", source)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
 }
 
-func (c *Collector) GetArrayOfString(name string) []string {
-	export, _ := c.GetValue(name).Export()
-	return export.([]string)
+func GS1200Collector(address string, password string, module Module) (*Collector, error) {
+	client, err := gs1200.NewClient(address, password)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return newCollector(client, module), nil
 }
 
-func (c *Collector) GetArrayOfArrayOfString(name string) [][]string {
-	export, _ := c.GetValue(name).Export()
-	return export.([][]string)
+// ReplayCollector collects the javascript files in dir, captured from the
+// switch at address, instead of the switch itself.
+func ReplayCollector(address string, dir string, module Module) (*Collector, error) {
+	client, err := gs1200.NewReplayClient(address, os.DirFS(dir))
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return newCollector(client, module), nil
 }
 
-func (c *Collector) GetArrayOfArrayOfInterface(name string) [][]interface{} {
-	export, _ := c.GetValue(name).Export()
-	return export.([][]interface{})
-}
+func newCollector(client *gs1200.Client, module Module) *Collector {
+	client.Pages = module.Pages
+	return &Collector{
+		client:     client,
+		module:     module,
+		onConflict: ConflictFail,
+		errors:     map[errorKey]float64{},
 
-func (c *Collector) GetArrayOfFloat(name string) []float64 {
-	array, _ := c.GetValue(name).Export()
-	result := []float64{}
-	for _, value := range array.([]interface{}) {
-		f, _ := value.(float64)
-		result = append(result, f)
+		parseErrors: map[string]float64{},
 	}
-	return result
 }
 
-func (c *Collector) Collect() (*SystemData, *[]PortData, error) {
-	vm = otto.New()
-	var loop_status []string
-	var portstatus []string
-	var speed []string
-	var stats [][]interface{}
-	var vlans [][]string
-	var port_power = []float64{}
+// Collect scrapes the switch, giving up when ctx is done. The phases of the
+// scrape are recorded in trace, which may be nil.
+func (c *Collector) Collect(ctx context.Context, trace *gs1200.Trace) (*gs1200.SystemData, []gs1200.PortData, error) {
+	return c.collect(ctx, trace, c.module)
+}
 
-	// Login
-	err := c.Login()
-	if err != nil {
-		return nil, nil, err
+// collect scrapes the pages of module.
+func (c *Collector) collect(ctx context.Context, trace *gs1200.Trace, module Module) (*gs1200.SystemData, []gs1200.PortData, error) {
+	if trace == nil {
+		trace = &gs1200.Trace{}
 	}
+	systemData, portData, err := c.client.CollectPages(ctx, trace, module.Pages)
 
-	// Fetch and parse the javascript files containing all the data.
-	for _, file := range []string{
-		"system_data.js",
-		"link_data.js",
-		"VLAN_1Q_List_data.js",
-	} {
-		js, err := c.FetchJS(file)
-		if err != nil {
-			return nil, nil, err
-		}
-		if err = c.ParseJS(js); err != nil {
-			return nil, nil, err
-		}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conflicts += float64(trace.Conflicts)
+	if err != nil {
+		c.errors[errorKey{trace.FailedPhase, reason(trace.FailedPhase, err)}]++
 	}
-	systemData = SystemData{
-		Max_port:    int64(c.GetInt("Max_port")),
-		model_name:  c.GetString("model_name"),
-		sys_fmw_ver: c.GetString("sys_fmw_ver"),
-		sys_IP:      c.GetString("sys_IP"),
-		sys_MAC:     c.GetString("sys_MAC"),
-		loop:        c.GetString("loop"),
+	if errors.Is(err, gs1200.ErrLoggedInElsewhere) && c.onConflict == ConflictYield && c.last != nil {
+		log.Info("Somebody else is logged in to ", c.client.Address(), ", serving the last collected data")
+		trace.FailedPhase, trace.Err = "", nil
+		return c.last.systemData, c.last.portData, nil
 	}
-	loop_status = c.GetArrayOfString("loop_status")
-	portstatus = c.GetArrayOfString("portstatus")
-	speed = c.GetArrayOfString("speed")
-	stats = c.GetArrayOfArrayOfInterface("Stats")
-	vlans = c.GetArrayOfArrayOfString("qvlans")
-
-	// Fetch PoE-data if applicable
-	if strings.HasSuffix(systemData.model_name, "HP v2") {
-		js, err := c.FetchJS("poe_data.js")
-		if err != nil {
-			return nil, nil, err
-		}
-		if err = c.ParseJS(js); err != nil {
-			return nil, nil, err
-		}
-		systemData.total_power = c.GetInt("total_power")
-		systemData.max_led_power = c.GetInt("max_led_power")
-		port_power = c.GetArrayOfFloat("port_power")
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Clear the session.
-	c.Logout()
-
-	// Report number of configured vlans.
-	for _, vlan := range vlans {
-		systemData.vlans = append(systemData.vlans, vlan[0])
+	for _, field := range systemData.ParseErrors {
+		c.parseErrors[field]++
 	}
 
-	// Loop over ports
-	portData = make([]PortData, systemData.Max_port)
-	for i := range portData {
-		portData[i].name = "port " + strconv.Itoa(i+1)
-		portData[i].loop_status = loop_status[i]
-		portData[i].portstatus = portstatus[i]
-		portData[i].pvlan = "0"
-		// Loop over configured vlans.
-		for _, vlan := range vlans {
-			// Parse vlan flags
-			flag1, _ := strconv.ParseInt(strings.ReplaceAll(vlan[1], "0x", ""), 16, 64)
-			if (flag1>>(i))&1 > 0 {
-				// Current vlan is connected to current port.
-				flag2, _ := strconv.ParseInt(strings.ReplaceAll(vlan[2], "0x", ""), 16, 64)
-				if (flag2>>(i))&1 > 0 {
-					// Tagged
-					portData[i].vlans = append(portData[i].vlans, vlan[0])
-				} else {
-					// Untagged
-					portData[i].pvlan = vlan[0]
-				}
-			}
-		}
-
-		// Port speed seems to always be "[num] [unit] [duplex]". Older versions
-		// did not show duplex status.
-		speedInfo := strings.Fields(speed[i])
-		portData[i].speed, _ = strconv.Atoi(speedInfo[0])
-		portData[i].speedUnit = speedInfo[1]
-		if len(speedInfo) > 2 {
-			portData[i].duplex = speedInfo[2]
-		} else {
-			portData[i].duplex = ""
-		}
-
-		// Sent/received traffic has a weird structure. This is what Zyxel's
-		// code does:
-		//
-		//   tx = Stats[k][1]+Stats[k][2]+Stats[k][3];
-		//   rx = Stats[k][6]+Stats[k][7]+Stats[k][8]+Stats[k][10];
-		//   tx = parseFloat(tx).toLocaleString(); //Divide the numbers with commas
-		//   rx = parseFloat(rx).toLocaleString();
-		portData[i].stats.tx = float64(stats[i][1].(int64) + stats[i][2].(int64) + stats[i][3].(int64))
-		portData[i].stats.rx = float64(stats[i][6].(int64) + stats[i][7].(int64) + stats[i][8].(int64) + stats[i][10].(int64))
-
-		// PoE data
-		if strings.HasSuffix(systemData.model_name, "HP v2") && i < 4 {
-			portData[i].stats.port_power = port_power[i]
+	// The switch rebooted when its uptime went backwards, which also resets
+	// its counters. An unknown uptime tells nothing.
+	if systemData.Uptime > 0 {
+		if systemData.Uptime < c.uptime {
+			log.Info(c.client.Address(), " rebooted")
+			c.reboots++
 		}
+		c.uptime = systemData.Uptime
 	}
-
-	return &systemData, &portData, nil
-}
-
-func (c *Collector) FetchJS(filename string) (string, error) {
-	fileUrl := "http://" + c.address + "/" + filename
-	log.Debug("Fetch " + fileUrl)
-	resp, err := client.Get(fileUrl)
-	if err != nil {
-		log.Debug("... fetch error: ", err)
-		c.Logout()
-		return "", err
-	}
-	if resp.StatusCode != 200 {
-		err := errors.New(resp.Status)
-		log.Debug("... fetch error: ", err)
-		c.Logout()
-		return "", err
-	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Debug("... fetch error: ", err)
-		c.Logout()
-		return "", err
+	c.last = &snapshot{
+		systemData: systemData,
+		portData:   portData,
+		time:       time.Now(),
 	}
+	return systemData, portData, nil
+}
 
-	return string(body), nil
+// Scrape scrapes the switch, or when polling in the background, returns the
+// last polled data.
+func (c *Collector) Scrape(ctx context.Context) *Scrape {
+	return c.ScrapeModule(ctx, c.module)
 }
 
-func (c *Collector) ParseJS(js string) error {
-	log.Debug("Parse JavaScript\n" + js)
-	_, err := vm.Run(js)
-	if err != nil {
-		log.Debug("... parse error: ", err)
-		c.Logout()
-		return err
+// ScrapeModule scrapes the pages of module instead of the collector's own.
+// When polling in the background, it returns the last polled data, of the
+// collector's own module.
+func (c *Collector) ScrapeModule(ctx context.Context, module Module) *Scrape {
+	scrape := &Scrape{Polled: c.Polling()}
+	if !scrape.Polled {
+		scrape.Trace = &gs1200.Trace{}
+		scrape.SystemData, scrape.PortData, scrape.Err = c.collect(ctx, scrape.Trace, module)
 	}
-	return nil
-}
 
-func (c *Collector) EncryptPassword(password string) string {
-	const letters = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	result := ""
-	for i := 0; i <= len(password); i++ {
-		result = result + string(letters[rand.Intn(len(letters))])
-		if i < len(password) {
-			result = result + string(rune(int(password[i])-len(password)))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if scrape.Polled {
+		scrape.Trace = c.lastPoll
+		switch {
+		case c.last != nil:
+			scrape.SystemData, scrape.PortData = c.last.systemData, c.last.portData
+		case c.lastPoll != nil:
+			scrape.Err = c.lastPoll.Err
+		default:
+			scrape.Err = errors.New("nothing polled yet")
 		}
 	}
-	return result
-}
-
-func (c *Collector) Login() error {
-	// Log in on the GS1200.
-
-	loginUrl := "http://" + c.address + "/login.cgi"
-	log.Debug("Logging in at " + loginUrl)
-	resp, err := client.PostForm(loginUrl, url.Values{"password": {c.EncryptPassword(c.password)}})
-	if err != nil {
-		log.Debug("... login error: ", err)
-		// Even though logging in failed, try to log out, clearing the
-		// session.
-		c.Logout()
-		return err
+	if c.last != nil {
+		scrape.Collected = c.last.time
 	}
-
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-	if resp.StatusCode != http.StatusOK {
-		log.Debug("... login error: ", err)
-		return errors.New(resp.Status)
+	scrape.Conflicts = c.conflicts
+	scrape.Reboots = c.reboots
+	scrape.Errors = make(map[errorKey]float64, len(c.errors))
+	for key, value := range c.errors {
+		scrape.Errors[key] = value
 	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Debug("... login read error: ", err)
-		c.Logout()
-		return err
+	scrape.ParseErrors = make(map[string]float64, len(c.parseErrors))
+	for field, value := range c.parseErrors {
+		scrape.ParseErrors[field] = value
 	}
+	return scrape
+}
 
-	// Somebody else is logged in.
-	if strings.Contains(string(body), "If a user is logged in already") {
-		log.Debug("... login failed, already logged in")
-		return errors.New("logged in elsewhere")
+// Snapshot returns the last successfully collected data and when it was
+// collected, or nil if nothing was collected yet.
+func (c *Collector) Snapshot() (*gs1200.SystemData, []gs1200.PortData, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last == nil {
+		return nil, nil, time.Time{}
 	}
+	return c.last.systemData, c.last.portData, c.last.time
+}
 
-	// Curiously, a failed login wil happily return 200.
-	if strings.Contains(string(body), "<title>Message</title>") &&
-		strings.Contains(string(body), "alert(\"Incorrect password, please try again.\");") {
-		log.Debug("... incorrect password")
-		c.Logout()
-		return errors.New("incorrect password")
-	}
+// Conflicts returns the number of times somebody else was logged in to the
+// switch.
+func (c *Collector) Conflicts() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conflicts
+}
 
-	return nil
+// Polling reports whether the collector polls in the background.
+func (c *Collector) Polling() bool {
+	return c.pollInterval > 0
 }
 
-func (c *Collector) Logout() {
-	logoutUrl := "http://" + c.address + "/logout.html"
-	log.Debug("Logging out at " + logoutUrl)
-	resp, err := client.Get(logoutUrl)
-	if err != nil {
-		log.Warn(err)
-		return
-	}
-	defer func() {
-		_ = resp.Body.Close()
+// Poll starts collecting data every poll interval in the background, until the
+// collector is closed. Scrapes are then served from the last polled data, so
+// the switch is polled once per interval regardless of the number of scrapers.
+// A poll may take up to one interval.
+func (c *Collector) Poll() {
+	stop, done := make(chan struct{}), make(chan struct{})
+	c.stop, c.done = stop, done
+	log.Info("Polling ", c.client.Address(), " every ", c.pollInterval)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
 	}()
-	_, err = io.Copy(io.Discard, resp.Body)
-	if err != nil {
-		log.Warn(err)
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(c.pollInterval)
+		defer ticker.Stop()
+		for {
+			trace := &gs1200.Trace{}
+			pollCtx, pollCancel := context.WithTimeout(ctx, c.pollInterval)
+			_, _, err := c.Collect(pollCtx, trace)
+			pollCancel()
+			if err != nil {
+				log.Error("Poll of ", c.client.Address(), " failed: ", err)
+			}
+			c.mu.Lock()
+			c.lastPoll = trace
+			c.mu.Unlock()
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Close stops background polling and ends a kept session, if any.
+func (c *Collector) Close() {
+	if c.stop != nil {
+		close(c.stop)
+		<-c.done
+		c.stop = nil
 	}
+	c.client.Close()
 }
@@ -1,301 +1,209 @@
 package internal
 
 import (
-	"embed"
 	"errors"
-	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/robertkrimen/otto"
+	"github.com/robinelfrink/gs1200-exporter/internal/samples"
+	"github.com/robinelfrink/gs1200-exporter/pkg/gs1200"
 )
 
-//go:embed samples/*
-var samples embed.FS
-
-func TestingDecryptPassword(password string) string {
-	result := []byte{}
-	for i := 1; i < len(password); i = i + 2 {
-		result = append(result, byte(int(password[i])+(len(password)/2)))
-	}
-	return string(result)
-}
-
-func TestingHandleRequest(rw http.ResponseWriter, req *http.Request) {
-	response := ""
-	if req.URL.String() == "/login.cgi" && req.Method == http.MethodPost {
-		if err := req.ParseForm(); err != nil {
-			rw.WriteHeader(http.StatusInternalServerError)
-			response = err.Error()
-		} else if TestingDecryptPassword(req.Form.Get("password")) != "OFcVQl1shaUM" {
-			rw.WriteHeader(http.StatusUnauthorized)
-		}
-	} else if req.URL.String() == "/logout.html" {
-	} else {
-		data, err := samples.ReadFile("samples" + req.URL.String())
-		if err != nil {
-			rw.WriteHeader(http.StatusNotFound)
-			response = err.Error()
-		} else {
-			response = string(data)
-		}
-	}
-	_, _ = rw.Write([]byte(response))
-}
-
-func TestCollector_Login(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(TestingHandleRequest))
-	// Close the server when test finishes
-	defer server.Close()
-
+// Retrying is up to the client, and tested there. The collector fails or
+// yields, and counts the conflict.
+func TestCollector_Conflict(t *testing.T) {
 	tests := []struct {
-		name     string
-		password string
-		wantErr  bool
+		name      string
+		policy    string
+		collected bool
+		wantErr   bool
 	}{
 		{
-			name:     "correct password",
-			password: "OFcVQl1shaUM",
-			wantErr:  false,
+			name:    "fail",
+			policy:  ConflictFail,
+			wantErr: true,
 		},
 		{
-			name:     "wrong password",
-			password: "Niovei4uR2ao",
-			wantErr:  true,
+			name:    "yield without data",
+			policy:  ConflictYield,
+			wantErr: true,
+		},
+		{
+			name:      "yield",
+			policy:    ConflictYield,
+			collected: true,
+			wantErr:   false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := &Collector{
-				address:  strings.Replace(server.URL, "http://", "", 1),
-				password: tt.password,
+			var mu sync.Mutex
+			busy := 0
+			fake := samples.TestingHandler(samples.Default)
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				if req.URL.String() == "/login.cgi" && busy > 0 {
+					busy--
+					_, _ = rw.Write([]byte("If a user is logged in already, please try again later."))
+					return
+				}
+				fake.ServeHTTP(rw, req)
+			}))
+			// Close the server when test finishes
+			defer server.Close()
+
+			c, _ := GS1200Collector(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM", DefaultModule)
+			c.onConflict = tt.policy
+			if tt.collected {
+				if _, _, err := c.Collect(t.Context(), nil); err != nil {
+					t.Fatalf("Collector.Collect() error = %v", err)
+				}
+			}
+			mu.Lock()
+			busy = 1
+			mu.Unlock()
+
+			s, p, err := c.Collect(t.Context(), nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Collector.Collect() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && !errors.Is(err, gs1200.ErrLoggedInElsewhere) {
+				t.Errorf("Collector.Collect() error = %v, want %v", err, gs1200.ErrLoggedInElsewhere)
 			}
-			if err := c.Login(); (err != nil) != tt.wantErr {
-				t.Errorf("Collector.Login() error = %v, wantErr %v", err, tt.wantErr)
+			if err == nil && (s.Model != "GS1200-8HP v2" || len(p) != 8) {
+				t.Errorf("Collector.Collect() = %v, %v ports", s.Model, len(p))
+			}
+			if got := c.Conflicts(); got != 1 {
+				t.Errorf("Collector.Conflicts() = %v, want 1", got)
+			}
+			key := errorKey{gs1200.PhaseLogin, "logged_in_elsewhere"}
+			if got := c.Scrape(t.Context()).Errors[key]; got != 1 {
+				t.Errorf("Collector.Scrape() errors = %v, want %v once", got, key)
 			}
 		})
 	}
 }
 
-func TestCollector_Logout(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(TestingHandleRequest))
+func TestCollector_Poll(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+	fake := samples.TestingHandler(samples.Default)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.String() == "/system_data.js" {
+			mu.Lock()
+			polls++
+			mu.Unlock()
+		}
+		fake.ServeHTTP(rw, req)
+	}))
 	// Close the server when test finishes
 	defer server.Close()
 
-	t.Run("logout", func(t *testing.T) {
-		c := &Collector{
-			address:  strings.Replace(server.URL, "http://", "", 1),
-			password: "unused",
-		}
-		c.Logout()
-	})
-}
+	c, _ := GS1200Collector(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM", DefaultModule)
+	c.pollInterval = 20 * time.Millisecond
+	if s, _, _ := c.Snapshot(); s != nil {
+		t.Errorf("Collector.Snapshot() = %v before polling", s)
+	}
+	c.Poll()
+	time.Sleep(110 * time.Millisecond)
+	c.Close()
 
-func TestCollector_EncryptPassword(t *testing.T) {
-	tests := []struct {
-		name     string
-		password string
-		match    string
-	}{
-		{
-			name:     "8 characters",
-			password: "xue2That",
-			match:    "^.p.m.].*.L.`.Y.l.$",
-		},
-		{
-			name:     "12 characters",
-			password: "Gae9ahVahzah",
-			match:    "^.;.U.Y.-.U.\\\\.J.U.\\\\.n.U.\\\\.$",
-		},
-		{
-			name:     "15 characters",
-			password: "muthuj0Eicha3ah",
-			match:    "^.\\^.f.e.Y.f.\\[.!.6.Z.T.Y.R.\\$.R.Y.$",
-		},
+	s, p, collected := c.Snapshot()
+	if s == nil || s.Model != "GS1200-8HP v2" || len(p) != 8 {
+		t.Fatalf("Collector.Snapshot() = %v, %v", s, p)
 	}
-	c := &Collector{
-		address:  "127.0.0.1",
-		password: "secret",
+	if age := time.Since(collected); age > time.Second {
+		t.Errorf("Collector.Snapshot() age = %v", age)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := c.EncryptPassword(tt.password)
-			match, err := regexp.MatchString(tt.match, got)
-			if err != nil {
-				t.Errorf("Collector.EncryptPassword() failed: %v", err)
-			} else if !match {
-				t.Errorf("Collector.EncryptPassword() = %v, should match %v", got, tt.match)
-			}
-		})
+	mu.Lock()
+	stopped := polls
+	mu.Unlock()
+	if stopped < 2 {
+		t.Errorf("Collector.Poll() polled %d times, want at least 2", stopped)
 	}
-}
-
-func TestCollector_FetchJS(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(TestingHandleRequest))
-	// Close the server when test finishes
-	defer server.Close()
 
-	tests := []struct {
-		filename string
-		size     int
-		wantErr  bool
-	}{
-		{
-			filename: "link_data.js",
-			size:     569,
-			wantErr:  false,
-		},
-		{
-			filename: "system_data.js",
-			size:     644,
-			wantErr:  false,
-		},
-		{
-			filename: "VLAN_1Q_List_data.js",
-			size:     166,
-			wantErr:  false,
-		},
-		{
-			filename: "world_peace.js",
-			size:     0,
-			wantErr:  true,
-		},
-	}
-	c := &Collector{
-		address:  strings.Replace(server.URL, "http://", "", 1),
-		password: "secret",
-	}
-	for _, tt := range tests {
-		t.Run(tt.filename, func(t *testing.T) {
-			got, err := c.FetchJS(tt.filename)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Collector.FetchJS(%v) error = %v, wantErr %v", tt.filename, err, tt.wantErr)
-				return
-			}
-			if !tt.wantErr && len(got) != tt.size {
-				t.Errorf("Collector.FetchJS(%v) = %v bytes, want %v bytes", tt.filename, len(got), tt.size)
-			}
-		})
+	// Polling has stopped.
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if polls != stopped {
+		t.Errorf("Collector.Poll() polled after Close()")
 	}
 }
 
-func TestCollector_ParseJS(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(TestingHandleRequest))
+func TestCollector_Reboots(t *testing.T) {
+	// Every scrape is served by a switch with another uptime.
+	var mu sync.Mutex
+	var fake http.Handler
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		handler := fake
+		mu.Unlock()
+		handler.ServeHTTP(rw, req)
+	}))
 	// Close the server when test finishes
 	defer server.Close()
 
-	tests := []struct {
-		filename string
-		key      string
-		want     string
-	}{
-		{
-			filename: "system_data.js",
-			key:      "model_name",
-			want:     "GS1200-8HP v2",
-		},
-		{
-			filename: "link_data.js",
-			key:      "portstatus",
-			want:     "Up,Down,Down,Down,Up,Down,Down,Up",
-		},
-		{
-			filename: "VLAN_1Q_List_data.js",
-			key:      "port_nums",
-			want:     "8",
-		},
+	c, _ := GS1200Collector(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM", DefaultModule)
+	// An unknown uptime is not taken for a reboot, nor hides one.
+	for _, u := range []string{"238", "300", "", "12", "unknown", "80"} {
+		mu.Lock()
+		fake = samples.Rewrite(samples.Default, "system_data.js", "'238'", "'"+u+"'")
+		mu.Unlock()
+		scrape := c.Scrape(t.Context())
+		if scrape.Err != nil {
+			t.Fatalf("Collector.Scrape() error = %v", scrape.Err)
+		}
+		want := u
+		if _, err := strconv.Atoi(u); err != nil {
+			want = "0"
+		}
+		if got := strconv.Itoa(int(scrape.SystemData.Uptime.Seconds())); got != want {
+			t.Errorf("Collector.Scrape() uptime = %v, want %v", got, want)
+		}
 	}
-	for _, tt := range tests {
-		t.Run(tt.filename, func(t *testing.T) {
-			c := &Collector{
-				address:  strings.Replace(server.URL, "http://", "", 1),
-				password: "secret",
-			}
-			js, err := c.FetchJS(tt.filename)
-			if err != nil {
-				t.Errorf("Collector.ParseJS(%v) error = %v", tt.filename, err)
-				return
-			}
-			vm = otto.New()
-			if err = c.ParseJS(js); err != nil {
-				t.Errorf("Collector.ParseJS(%v) error = %v", tt.filename, err)
-				return
-			}
-			got, err := vm.Get(tt.key)
-			if err != nil {
-				t.Errorf("Collector.ParseJS(%v) error = %v", tt.filename, err)
-				return
-			}
-			if got.String() != tt.want {
-				t.Errorf("Collector.ParseJS() error = failed key %v: %v, want %v", tt.key, got.String(), tt.want)
-			}
-		})
+	if got := c.Scrape(t.Context()).Reboots; got != 1 {
+		t.Errorf("Collector.Scrape() reboots = %v, want 1", got)
 	}
 }
 
-func TestCollector_Collect(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(TestingHandleRequest))
-	// Close the server when test finishes
-	defer server.Close()
-
+func TestCheckSource(t *testing.T) {
 	tests := []struct {
-		name string
-		ok   func(SystemData, []PortData) error
+		source string
+		ok     bool
 	}{
 		{
-			name: "model name",
-			ok: func(s SystemData, p []PortData) error {
-				if s.model_name == "GS1200-8HP v2" {
-					return nil
-				}
-				return errors.New(s.model_name)
-			},
+			source: SourceSwitch,
+			ok:     true,
 		},
 		{
-			name: "port 5 speed",
-			ok: func(s SystemData, p []PortData) error {
-				if p[4].speed == 1000 {
-					return nil
-				}
-				return fmt.Errorf("%d", p[4].speed)
-			},
+			source: "dir:samples/" + samples.Default,
+			ok:     true,
 		},
 		{
-			name: "port 3 primary vlan",
-			ok: func(s SystemData, p []PortData) error {
-				if p[2].pvlan == "1" {
-					return nil
-				}
-				return errors.New(p[2].pvlan)
-			},
+			source: "dir:samples/nonexistent",
+			ok:     false,
 		},
 		{
-			name: "max led power",
-			ok: func(s SystemData, p []PortData) error {
-				if s.max_led_power == 50 {
-					return nil
-				}
-				return fmt.Errorf("%d", s.max_led_power)
-			},
+			source: "dir:samples/samples.go",
+			ok:     false,
+		},
+		{
+			source: "samples/" + samples.Default,
+			ok:     false,
 		},
 	}
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			c := &Collector{
-				address:  strings.Replace(server.URL, "http://", "", 1),
-				password: "OFcVQl1shaUM",
-			}
-			s, p, err := c.Collect()
-			if err != nil {
-				t.Errorf("Collector.Collect() error = %v", err)
-				return
-			}
-			if err := tt.ok(*s, *p); err != nil {
-				t.Errorf("Collector.Collect() error = wrong value %v", err)
-				return
+		t.Run(tt.source, func(t *testing.T) {
+			if err := CheckSource(tt.source); (err == nil) != tt.ok {
+				t.Errorf("CheckSource() error = %v, want ok %v", err, tt.ok)
 			}
 		})
 	}
@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/robinelfrink/gs1200-exporter/pkg/gs1200"
+
+	"go.yaml.in/yaml/v3"
+)
+
+type Config struct {
+	Switches []SwitchConfig    `yaml:"switches"`
+	Modules  map[string]Module `yaml:"modules"`
+
+	// Whether /metrics distinguishes switches by a target label.
+	targetLabel bool
+}
+
+type SwitchConfig struct {
+	Name            string            `yaml:"name"`
+	Address         string            `yaml:"address"`
+	Password        string            `yaml:"password"`
+	PasswordFile    string            `yaml:"password_file"`
+	Labels          map[string]string `yaml:"labels"`
+	Module          string            `yaml:"module"`
+	KeepSession     bool              `yaml:"keep_session"`
+	OnConflict      string            `yaml:"on_conflict"`
+	ConflictTimeout time.Duration     `yaml:"conflict_timeout"`
+	PollInterval    time.Duration     `yaml:"poll_interval"`
+}
+
+var labelNameRE = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// DefaultConfig describes the single switch given by the command line flags
+// or environment.
+func DefaultConfig(sw SwitchConfig) (*Config, error) {
+	config := &Config{
+		Switches: []SwitchConfig{sw},
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadConfig reads and validates a configuration file. Password files are
+// read right away, so a missing file is noticed at startup.
+func LoadConfig(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{targetLabel: true}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	for name, module := range c.Modules {
+		for _, page := range module.Pages {
+			if !gs1200.ValidPage(page) {
+				return fmt.Errorf("module %q: unknown page %q", name, page)
+			}
+		}
+	}
+
+	if len(c.Switches) == 0 {
+		return errors.New("no switches configured")
+	}
+	names := map[string]bool{}
+	for i := range c.Switches {
+		sw := &c.Switches[i]
+		if sw.Address == "" {
+			return fmt.Errorf("switch %d: no address", i+1)
+		}
+		if sw.Name == "" {
+			sw.Name = sw.Address
+		}
+		if names[sw.Name] {
+			return fmt.Errorf("switch %q: duplicate name", sw.Name)
+		}
+		names[sw.Name] = true
+
+		if sw.Password != "" && sw.PasswordFile != "" {
+			return fmt.Errorf("switch %q: password and password_file are mutually exclusive", sw.Name)
+		}
+		if sw.PasswordFile != "" {
+			password, err := os.ReadFile(sw.PasswordFile)
+			if err != nil {
+				return fmt.Errorf("switch %q: %w", sw.Name, err)
+			}
+			sw.Password = strings.TrimRight(string(password), "\r\n")
+		}
+		if sw.Password == "" {
+			return fmt.Errorf("switch %q: no password or password_file", sw.Name)
+		}
+
+		for label := range sw.Labels {
+			if !labelNameRE.MatchString(label) || strings.HasPrefix(label, "__") {
+				return fmt.Errorf("switch %q: invalid label name %q", sw.Name, label)
+			}
+			if label == "target" {
+				return fmt.Errorf("switch %q: label name %q is reserved", sw.Name, label)
+			}
+		}
+
+		switch sw.OnConflict {
+		case "":
+			sw.OnConflict = ConflictFail
+		case ConflictFail, ConflictRetry, ConflictYield:
+		default:
+			return fmt.Errorf("switch %q: unknown on_conflict policy %q", sw.Name, sw.OnConflict)
+		}
+		if sw.ConflictTimeout < 0 {
+			return fmt.Errorf("switch %q: negative conflict_timeout", sw.Name)
+		}
+		if sw.ConflictTimeout == 0 {
+			sw.ConflictTimeout = DefaultConflictTimeout
+		}
+
+		if sw.PollInterval < 0 {
+			return fmt.Errorf("switch %q: negative poll_interval", sw.Name)
+		}
+
+		if sw.Module == "" {
+			sw.Module = defaultModule
+		}
+		if _, ok := c.Module(sw.Module); !ok {
+			return fmt.Errorf("switch %q: unknown module %q", sw.Name, sw.Module)
+		}
+	}
+	c.fillLabels()
+	return nil
+}
+
+// fillLabels gives every switch the labels of all switches, empty where it
+// has none, as the metrics of all switches must have the same label names.
+func (c *Config) fillLabels() {
+	names := map[string]bool{}
+	for _, sw := range c.Switches {
+		for name := range sw.Labels {
+			names[name] = true
+		}
+	}
+	for i := range c.Switches {
+		sw := &c.Switches[i]
+		if sw.Labels == nil {
+			sw.Labels = map[string]string{}
+		}
+		for name := range names {
+			if _, ok := sw.Labels[name]; !ok {
+				sw.Labels[name] = ""
+			}
+		}
+	}
+}
+
+// Module looks up a module by name. The default module can be overridden in
+// the configuration file.
+func (c *Config) Module(name string) (Module, bool) {
+	if module, ok := c.Modules[name]; ok {
+		return module, true
+	}
+	if name == defaultModule {
+		return DefaultModule, true
+	}
+	return Module{}, false
+}
+
+// Switch looks up a switch by name or address.
+func (c *Config) Switch(target string) *SwitchConfig {
+	for i := range c.Switches {
+		if c.Switches[i].Name == target || c.Switches[i].Address == target {
+			return &c.Switches[i]
+		}
+	}
+	return nil
+}
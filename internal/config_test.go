@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robinelfrink/gs1200-exporter/internal/samples"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("OFcVQl1shaUM\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			config: `
+switches:
+  - name: core
+    address: 192.168.1.3
+    password_file: ` + passwordFile + `
+    labels:
+      site: ams
+    module: minimal
+  - address: 192.168.1.4
+    password: secret
+    on_conflict: retry
+    conflict_timeout: 8s
+modules:
+  minimal:
+    pages: [link]
+`,
+		},
+		{
+			name:    "no switches",
+			config:  "modules: {}\n",
+			wantErr: "no switches configured",
+		},
+		{
+			name:    "unknown field",
+			config:  "switches:\n  - address: 192.168.1.3\n    pasword: secret\n",
+			wantErr: "field pasword not found",
+		},
+		{
+			name:    "no address",
+			config:  "switches:\n  - password: secret\n",
+			wantErr: "switch 1: no address",
+		},
+		{
+			name:    "no password",
+			config:  "switches:\n  - address: 192.168.1.3\n",
+			wantErr: `switch "192.168.1.3": no password or password_file`,
+		},
+		{
+			name:    "both passwords",
+			config:  "switches:\n  - address: 192.168.1.3\n    password: secret\n    password_file: " + passwordFile + "\n",
+			wantErr: "mutually exclusive",
+		},
+		{
+			name:    "missing password file",
+			config:  "switches:\n  - address: 192.168.1.3\n    password_file: " + filepath.Join(dir, "missing") + "\n",
+			wantErr: "no such file or directory",
+		},
+		{
+			name:    "duplicate name",
+			config:  "switches:\n  - address: 192.168.1.3\n    password: secret\n  - address: 192.168.1.3\n    password: secret\n",
+			wantErr: `switch "192.168.1.3": duplicate name`,
+		},
+		{
+			name:    "invalid label",
+			config:  "switches:\n  - address: 192.168.1.3\n    password: secret\n    labels:\n      rack-id: r1\n",
+			wantErr: `invalid label name "rack-id"`,
+		},
+		{
+			name:    "reserved label",
+			config:  "switches:\n  - address: 192.168.1.3\n    password: secret\n    labels:\n      target: r1\n",
+			wantErr: `label name "target" is reserved`,
+		},
+		{
+			name:    "unknown module",
+			config:  "switches:\n  - address: 192.168.1.3\n    password: secret\n    module: full\n",
+			wantErr: `unknown module "full"`,
+		},
+		{
+			name:    "unknown conflict policy",
+			config:  "switches:\n  - address: 192.168.1.3\n    password: secret\n    on_conflict: wait\n",
+			wantErr: `unknown on_conflict policy "wait"`,
+		},
+		{
+			name:    "unknown page",
+			config:  "switches:\n  - address: 192.168.1.3\n    password: secret\nmodules:\n  full:\n    pages: [world_peace]\n",
+			wantErr: `module "full": unknown page "world_peace"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(dir, "config.yaml")
+			if err := os.WriteFile(filename, []byte(tt.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadConfig(filename)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadConfig() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("LoadConfig() error = %v", err)
+				return
+			}
+			if got := config.Switch("core").Password; got != "OFcVQl1shaUM" {
+				t.Errorf("LoadConfig() password = %v, want OFcVQl1shaUM", got)
+			}
+			if got := config.Switch("192.168.1.4"); got == nil || got.Module != defaultModule {
+				t.Errorf("LoadConfig() switch 192.168.1.4 = %v, want module %v", got, defaultModule)
+			}
+			if got := config.Switch("192.168.1.4").ConflictTimeout; got != 8*time.Second {
+				t.Errorf("LoadConfig() conflict timeout = %v, want 8s", got)
+			}
+			if got := config.Switch("core").OnConflict; got != ConflictFail {
+				t.Errorf("LoadConfig() conflict policy = %v, want %v", got, ConflictFail)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_MixedLabels(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	config := `
+switches:
+  - name: core
+    address: 192.168.1.3
+    password: secret
+    labels:
+      site: ams
+  - name: rack
+    address: 192.168.1.4
+    password: secret
+    labels:
+      site: ams
+      rack: r1
+  - address: 192.168.1.5
+    password: secret
+`
+	if err := os.WriteFile(filename, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	want := map[string]string{
+		"core":        "map[rack: site:ams]",
+		"rack":        "map[rack:r1 site:ams]",
+		"192.168.1.5": "map[rack: site:]",
+	}
+	for name, labels := range want {
+		if got := fmt.Sprint(c.Switch(name).Labels); got != labels {
+			t.Errorf("LoadConfig() switch %v labels = %v, want %v", name, got, labels)
+		}
+	}
+
+	// The switches can be registered side by side.
+	s := GS1200Server(c, "", "9934")
+	s.Source = SourceDirPrefix + "samples/" + samples.Default
+	defer s.close()
+	if err := s.register(t.Context(), prometheus.NewRegistry()); err != nil {
+		t.Errorf("Server.register() error = %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"errors"
+	"net"
+
+	"github.com/robinelfrink/gs1200-exporter/pkg/gs1200"
+)
+
+// errorKey identifies a counter of failed scrapes.
+type errorKey struct {
+	phase  string
+	reason string
+}
+
+// reason classifies the error of a failed phase.
+func reason(phase string, err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, gs1200.ErrIncorrectPassword):
+		return "incorrect_password"
+	case errors.Is(err, gs1200.ErrLoggedInElsewhere):
+		return "logged_in_elsewhere"
+	case errors.Is(err, gs1200.ErrSessionExpired):
+		return "session_expired"
+	case errors.Is(err, gs1200.ErrUnexpectedStatus):
+		return "http_status"
+	case errors.Is(err, gs1200.ErrResponseTooLarge):
+		return "response_too_large"
+	case errors.Is(err, gs1200.ErrScriptTimeout):
+		return "script_timeout"
+	case phase == gs1200.PhaseParse:
+		return "parse_error"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &netErr):
+		return "network"
+	}
+	return "other"
+}
@@ -1,12 +1,13 @@
 package internal
 
 import (
-	"net/http"
+	"context"
 	"strconv"
-	"strings"
+	"time"
+
+	"github.com/robinelfrink/gs1200-exporter/pkg/gs1200"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -16,96 +17,328 @@ const (
 )
 
 var (
-	num_ports_metric = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "num_ports"),
-		"Number of ports. Mainly a placeholder for system information.",
-		[]string{"model", "firmware", "ip", "mac", "loop"}, nil)
-	num_vlans_metric = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "num_vlans"),
-		"Number of configured vlans.",
-		[]string{"vlans"}, nil)
-	speed_metric = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "speed"),
-		"Port speed.",
-		[]string{"port", "status", "loop", "pvlan", "vlans", "unit", "duplex"}, nil)
-	tx_metric = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "packets_tx"),
-		"Number of packets transmitted.",
+	info_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "info"),
+		"Information about the switch, always 1.",
+		[]string{"model", "firmware", "ip", "mac"}, nil)
+	uptime_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "uptime_seconds"),
+		"Time since the switch booted.",
+		nil, nil)
+	build_date_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "firmware_build_timestamp_seconds"),
+		"Time the switch's firmware was built.",
+		nil, nil)
+	reboots_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "reboots_total"),
+		"Number of times the switch was seen rebooting, by its uptime going backwards.",
+		nil, nil)
+	vlan_info_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "vlan_info"),
+		"Configured VLAN, always 1.",
+		[]string{"vlan"}, nil)
+	vlan_port_member_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "vlan_port_member"),
+		"Membership of a port in a VLAN, always 1.",
+		[]string{"vlan", "port", "mode"}, nil)
+	port_info_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "port_info"),
+		"Configuration of the port, always 1.",
+		[]string{"port", "pvid"}, nil)
+	port_up_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "port_up"),
+		"Whether the port's link is up.",
+		[]string{"port"}, nil)
+	port_speed_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "port_speed_bits_per_second"),
+		"Negotiated speed of the port, 0 if the link is down.",
+		[]string{"port"}, nil)
+	port_full_duplex_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "port_full_duplex"),
+		"Whether the port runs in full duplex.",
 		[]string{"port"}, nil)
-	rx_metric = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "packets_rx"),
-		"Number of packets received.",
+	port_loop_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "port_loop_detected"),
+		"Whether a loop was detected on the port.",
 		[]string{"port"}, nil)
-	power_metric = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "power"),
-		"Power usage in Watts.",
+	packets_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "port_packets_total"),
+		"Number of packets, as totalled by the web interface.",
+		[]string{"port", "direction"}, nil)
+	unicast_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "port_unicast_packets_total"),
+		"Number of unicast packets.",
+		[]string{"port", "direction"}, nil)
+	multicast_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "port_multicast_packets_total"),
+		"Number of multicast packets.",
+		[]string{"port", "direction"}, nil)
+	broadcast_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "port_broadcast_packets_total"),
+		"Number of broadcast packets.",
+		[]string{"port", "direction"}, nil)
+	stats_column_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "port_stats_column_total"),
+		"Raw value of a column of the switch's port statistics whose meaning is not known.",
+		[]string{"port", "column"}, nil)
+	poe_budget_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "poe_power_budget_watts"),
+		"Power available to PoE ports.",
+		nil, nil)
+	poe_draw_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "poe_power_draw_watts"),
+		"Power drawn by PoE ports.",
+		nil, nil)
+	poe_remaining_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "poe_power_remaining_watts"),
+		"Power left in the PoE budget.",
+		nil, nil)
+	poe_led_threshold_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "poe_led_threshold_watts"),
+		"PoE draw above which the switch's PoE LED lights up.",
+		nil, nil)
+	port_poe_power_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "port_poe_power_watts"),
+		"Power drawn by the port.",
 		[]string{"port"}, nil)
-	max_power_metric = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "max_power"),
-		"Maximum power available to PoE ports in Watts.",
-		[]string{"led"}, nil)
+	port_poe_delivering_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "port_poe_delivering"),
+		"Whether the port delivers power.",
+		[]string{"port"}, nil)
+	session_conflicts_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "session_conflicts_total"),
+		"Number of times somebody else was logged in to the switch.",
+		nil, nil)
+	snapshot_age_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "snapshot_age_seconds"),
+		"Age of the data collected by background polling.",
+		nil, nil)
+	up_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "up"),
+		"Whether the last scrape of the switch succeeded.",
+		nil, nil)
+	scrape_duration_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "scrape_duration_seconds"),
+		"Duration of the last scrape of the switch.",
+		nil, nil)
+	scrape_phase_duration_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "scrape_phase_duration_seconds"),
+		"Duration of each phase of the last scrape of the switch.",
+		[]string{"phase", "file"}, nil)
+	scrape_errors_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "scrape_errors_total"),
+		"Number of failed scrapes of the switch.",
+		[]string{"phase", "reason"}, nil)
+	parse_errors_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "parse_errors_total"),
+		"Number of times a field of the switch's data could not be parsed, and was left out.",
+		[]string{"field"}, nil)
+	last_success_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "last_successful_scrape_timestamp_seconds"),
+		"Time of the last successful scrape of the switch.",
+		nil, nil)
 )
 
+// Source is what the exporter reports on, normally a Collector.
+type Source interface {
+	Scrape(ctx context.Context) *Scrape
+}
+
+// Exporter reports on a source for a single request, whose context bounds the
+// scrape of the switch.
 type Exporter struct {
-	port      string
-	collector Collector
+	ctx    context.Context
+	source Source
+	legacy string
 }
 
-func GS1200Exporter(collector Collector, port string) *Exporter {
+func GS1200Exporter(ctx context.Context, source Source) *Exporter {
 	return &Exporter{
-		collector: collector,
-		port:      port,
+		ctx:    ctx,
+		source: source,
+		legacy: LegacyOff,
 	}
 }
 
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- num_ports_metric
-	ch <- num_vlans_metric
-	ch <- speed_metric
-	ch <- tx_metric
-	ch <- rx_metric
-	ch <- power_metric
-	ch <- max_power_metric
-}
-
-func (e *Exporter) Run() {
-	prometheus.MustRegister(e)
-	http.Handle("/metrics", promhttp.Handler())
-	log.Info("Listening for requests on port ", e.port)
-	log.Fatal(http.ListenAndServe(":"+string(e.port), nil))
+	ch <- info_metric
+	ch <- uptime_metric
+	ch <- build_date_metric
+	ch <- reboots_metric
+	ch <- vlan_info_metric
+	ch <- vlan_port_member_metric
+	ch <- port_info_metric
+	ch <- port_up_metric
+	ch <- port_speed_metric
+	ch <- port_full_duplex_metric
+	ch <- port_loop_metric
+	ch <- packets_metric
+	ch <- unicast_metric
+	ch <- multicast_metric
+	ch <- broadcast_metric
+	ch <- stats_column_metric
+	ch <- poe_budget_metric
+	ch <- poe_draw_metric
+	ch <- poe_remaining_metric
+	ch <- poe_led_threshold_metric
+	ch <- port_poe_power_metric
+	ch <- port_poe_delivering_metric
+	ch <- session_conflicts_metric
+	ch <- snapshot_age_metric
+	ch <- up_metric
+	ch <- scrape_duration_metric
+	ch <- scrape_phase_duration_metric
+	ch <- scrape_errors_metric
+	ch <- parse_errors_metric
+	ch <- last_success_metric
+	describeSettings(ch)
+	describeTrunks(ch)
+	describeLegacy(ch)
 }
 
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	systemData, portData, err := e.collector.Collect()
-	if err != nil {
-		log.Error("Collect failed")
+	scrape := e.source.Scrape(e.ctx)
+
+	// Health metrics are always reported, so a failing switch can be told
+	// apart from a missing one.
+	up := 0.0
+	if scrape.Err == nil && scrape.Trace != nil && scrape.Trace.Err == nil {
+		up = 1
+	}
+	ch <- prometheus.MustNewConstMetric(up_metric, prometheus.GaugeValue, up)
+	if scrape.Trace != nil {
+		ch <- prometheus.MustNewConstMetric(scrape_duration_metric, prometheus.GaugeValue,
+			scrape.Trace.Duration.Seconds())
+		for _, phase := range scrape.Trace.Phases {
+			ch <- prometheus.MustNewConstMetric(scrape_phase_duration_metric, prometheus.GaugeValue,
+				phase.Duration.Seconds(), phase.Name, phase.File)
+		}
+	}
+	for key, count := range scrape.Errors {
+		ch <- prometheus.MustNewConstMetric(scrape_errors_metric, prometheus.CounterValue,
+			count, key.phase, key.reason)
+	}
+	for field, count := range scrape.ParseErrors {
+		ch <- prometheus.MustNewConstMetric(parse_errors_metric, prometheus.CounterValue,
+			count, field)
+	}
+	if !scrape.Collected.IsZero() {
+		ch <- prometheus.MustNewConstMetric(last_success_metric, prometheus.GaugeValue,
+			float64(scrape.Collected.UnixNano())/1e9)
+		if scrape.Polled {
+			ch <- prometheus.MustNewConstMetric(snapshot_age_metric, prometheus.GaugeValue,
+				time.Since(scrape.Collected).Seconds())
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(session_conflicts_metric, prometheus.CounterValue,
+		scrape.Conflicts)
+	ch <- prometheus.MustNewConstMetric(reboots_metric, prometheus.CounterValue,
+		scrape.Reboots)
+	if scrape.Err != nil {
+		log.Error("Collect failed: ", scrape.Err)
 		return
 	}
+	systemData, portData := scrape.SystemData, scrape.PortData
+
+	if e.legacy != LegacyOnly {
+		collectMetrics(ch, systemData, portData)
+	}
+	if e.legacy != LegacyOff {
+		collectLegacy(ch, systemData, portData)
+	}
+}
 
-	ch <- prometheus.MustNewConstMetric(num_ports_metric, prometheus.GaugeValue,
-		float64(systemData.Max_port), systemData.model_name, systemData.sys_fmw_ver,
-		systemData.sys_IP, systemData.sys_MAC, systemData.loop)
+// collectMetrics reports the switch's data.
+func collectMetrics(ch chan<- prometheus.Metric, systemData *gs1200.SystemData, portData []gs1200.PortData) {
+	ch <- prometheus.MustNewConstMetric(info_metric, prometheus.GaugeValue,
+		1, systemData.Model, systemData.Firmware, systemData.IP, systemData.MAC)
+	if systemData.Uptime > 0 {
+		ch <- prometheus.MustNewConstMetric(uptime_metric, prometheus.GaugeValue,
+			systemData.Uptime.Seconds())
+	}
+	if !systemData.BuildDate.IsZero() {
+		ch <- prometheus.MustNewConstMetric(build_date_metric, prometheus.GaugeValue,
+			float64(systemData.BuildDate.Unix()))
+	}
+	collectSettings(ch, systemData.Settings)
 
-	ch <- prometheus.MustNewConstMetric(num_vlans_metric, prometheus.GaugeValue,
-		float64(len(systemData.vlans)), strings.Join(systemData.vlans, ","))
+	// PoE values the switch served invalid are left out.
+	if systemData.TotalPower != nil {
+		ch <- prometheus.MustNewConstMetric(poe_budget_metric, prometheus.GaugeValue,
+			float64(*systemData.TotalPower))
+	}
+	if systemData.RealPower != nil {
+		ch <- prometheus.MustNewConstMetric(poe_draw_metric, prometheus.GaugeValue,
+			*systemData.RealPower)
+	}
+	if systemData.TotalPower != nil && systemData.RealPower != nil {
+		ch <- prometheus.MustNewConstMetric(poe_remaining_metric, prometheus.GaugeValue,
+			float64(*systemData.TotalPower)-*systemData.RealPower)
+	}
+	if systemData.MaxLEDPower != nil {
+		ch <- prometheus.MustNewConstMetric(poe_led_threshold_metric, prometheus.GaugeValue,
+			float64(*systemData.MaxLEDPower))
+	}
 
-	if strings.HasSuffix(systemData.model_name, "HP v2") {
-		ch <- prometheus.MustNewConstMetric(max_power_metric, prometheus.GaugeValue,
-			float64(systemData.total_power), strconv.Itoa(systemData.max_led_power))
+	for _, vlan := range systemData.VLANs {
+		ch <- prometheus.MustNewConstMetric(vlan_info_metric, prometheus.GaugeValue,
+			1, vlan)
 	}
 
-	for i, port := range *portData {
-		ch <- prometheus.MustNewConstMetric(speed_metric, prometheus.GaugeValue,
-			float64(port.speed), port.name, port.portstatus, port.loop_status,
-			port.pvlan, strings.Join(port.vlans, ","), port.speedUnit, port.duplex)
-		ch <- prometheus.MustNewConstMetric(rx_metric, prometheus.GaugeValue,
-			port.stats.rx, port.name)
-		ch <- prometheus.MustNewConstMetric(tx_metric, prometheus.GaugeValue,
-			port.stats.tx, port.name)
-		if strings.HasSuffix(systemData.model_name, "HP v2") && i < 4 {
-			ch <- prometheus.MustNewConstMetric(power_metric, prometheus.GaugeValue,
-				port.stats.port_power, port.name)
+	for i, port := range portData {
+		if i < systemData.PoEPorts {
+			ch <- prometheus.MustNewConstMetric(port_poe_power_metric, prometheus.GaugeValue,
+				port.Stats.Power, port.Name)
+			ch <- prometheus.MustNewConstMetric(port_poe_delivering_metric, prometheus.GaugeValue,
+				boolValue(port.Stats.Power > 0), port.Name)
+		}
+		if port.PVID > 0 {
+			ch <- prometheus.MustNewConstMetric(port_info_metric, prometheus.GaugeValue,
+				1, port.Name, strconv.Itoa(port.PVID))
+		}
+		for _, vlan := range port.UntaggedVLANs {
+			ch <- prometheus.MustNewConstMetric(vlan_port_member_metric, prometheus.GaugeValue,
+				1, vlan, port.Name, "untagged")
+		}
+		for _, vlan := range port.VLANs {
+			ch <- prometheus.MustNewConstMetric(vlan_port_member_metric, prometheus.GaugeValue,
+				1, vlan, port.Name, "tagged")
+		}
+		ch <- prometheus.MustNewConstMetric(port_up_metric, prometheus.GaugeValue,
+			boolValue(port.Status == "Up"), port.Name)
+		ch <- prometheus.MustNewConstMetric(port_speed_metric, prometheus.GaugeValue,
+			port.BitsPerSecond(), port.Name)
+		ch <- prometheus.MustNewConstMetric(port_full_duplex_metric, prometheus.GaugeValue,
+			boolValue(port.Duplex == "Full"), port.Name)
+		ch <- prometheus.MustNewConstMetric(port_loop_metric, prometheus.GaugeValue,
+			boolValue(port.LoopStatus == "Loop"), port.Name)
+		ch <- prometheus.MustNewConstMetric(packets_metric, prometheus.CounterValue,
+			port.Stats.RX, port.Name, "rx")
+		ch <- prometheus.MustNewConstMetric(packets_metric, prometheus.CounterValue,
+			port.Stats.TX, port.Name, "tx")
+		collectCounters(ch, port.Name, "rx", port.Stats.RXCounters)
+		collectCounters(ch, port.Name, "tx", port.Stats.TXCounters)
+		for column, value := range port.Stats.Columns {
+			ch <- prometheus.MustNewConstMetric(stats_column_metric, prometheus.CounterValue,
+				value, port.Name, strconv.Itoa(column))
 		}
 	}
+	collectTrunks(ch, systemData.Trunks, portData)
+}
+
+// collectCounters reports the packet counters of a port in one direction.
+func collectCounters(ch chan<- prometheus.Metric, port string, direction string, counters gs1200.PortCounters) {
+	ch <- prometheus.MustNewConstMetric(unicast_metric, prometheus.CounterValue,
+		counters.Unicast, port, direction)
+	ch <- prometheus.MustNewConstMetric(multicast_metric, prometheus.CounterValue,
+		counters.Multicast, port, direction)
+	ch <- prometheus.MustNewConstMetric(broadcast_metric, prometheus.CounterValue,
+		counters.Broadcast, port, direction)
+}
 
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,313 @@
+package internal
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/robinelfrink/gs1200-exporter/internal/samples"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestExporter_Health(t *testing.T) {
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+	address := strings.Replace(server.URL, "http://", "", 1)
+
+	tests := []struct {
+		name     string
+		password string
+		want     string
+		phases   int
+	}{
+		{
+			name:     "success",
+			password: "OFcVQl1shaUM",
+			want: `
+# HELP gs1200_up Whether the last scrape of the switch succeeded.
+# TYPE gs1200_up gauge
+gs1200_up 1
+`,
+			// Login, logout, and fetch and parse of four files.
+			phases: 10,
+		},
+		{
+			name:     "incorrect password",
+			password: "Niovei4uR2ao",
+			want: `
+# HELP gs1200_scrape_errors_total Number of failed scrapes of the switch.
+# TYPE gs1200_scrape_errors_total counter
+gs1200_scrape_errors_total{phase="login",reason="incorrect_password"} 1
+# HELP gs1200_up Whether the last scrape of the switch succeeded.
+# TYPE gs1200_up gauge
+gs1200_up 0
+`,
+			phases: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector, _ := GS1200Collector(address, tt.password, DefaultModule)
+			exporter := GS1200Exporter(t.Context(), collector)
+			if err := testutil.CollectAndCompare(exporter, strings.NewReader(tt.want),
+				"gs1200_up", "gs1200_scrape_errors_total"); err != nil {
+				t.Errorf("Exporter.Collect() %v", err)
+			}
+			if got := testutil.CollectAndCount(exporter, "gs1200_scrape_phase_duration_seconds"); got != tt.phases {
+				t.Errorf("Exporter.Collect() = %d phase durations, want %d", got, tt.phases)
+			}
+			if got := testutil.CollectAndCount(exporter, "gs1200_scrape_duration_seconds"); got != 1 {
+				t.Errorf("Exporter.Collect() = %d scrape durations, want 1", got)
+			}
+		})
+	}
+}
+
+func TestExporter_Legacy(t *testing.T) {
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+	address := strings.Replace(server.URL, "http://", "", 1)
+
+	tests := []struct {
+		legacy  string
+		current int
+		speed   int
+		vlans   int
+	}{
+		{
+			legacy:  LegacyOff,
+			current: 8,
+			speed:   0,
+			vlans:   0,
+		},
+		{
+			legacy:  LegacyAlongside,
+			current: 8,
+			speed:   8,
+			vlans:   1,
+		},
+		{
+			legacy:  LegacyOnly,
+			current: 0,
+			speed:   8,
+			vlans:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.legacy, func(t *testing.T) {
+			collector, _ := GS1200Collector(address, "OFcVQl1shaUM", DefaultModule)
+			exporter := GS1200Exporter(t.Context(), collector)
+			exporter.legacy = tt.legacy
+			if got := testutil.CollectAndCount(exporter, "gs1200_port_up"); got != tt.current {
+				t.Errorf("Exporter.Collect() = %d gs1200_port_up, want %d", got, tt.current)
+			}
+			if got := testutil.CollectAndCount(exporter, "gs1200_speed"); got != tt.speed {
+				t.Errorf("Exporter.Collect() = %d gs1200_speed, want %d", got, tt.speed)
+			}
+			if got := testutil.CollectAndCount(exporter, "gs1200_num_vlans"); got != tt.vlans {
+				t.Errorf("Exporter.Collect() = %d gs1200_num_vlans, want %d", got, tt.vlans)
+			}
+		})
+	}
+}
+
+func TestExporter_PoE(t *testing.T) {
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+
+	collector, _ := GS1200Collector(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM", DefaultModule)
+	exporter := GS1200Exporter(t.Context(), collector)
+	want := `
+# HELP gs1200_poe_power_budget_watts Power available to PoE ports.
+# TYPE gs1200_poe_power_budget_watts gauge
+gs1200_poe_power_budget_watts 60
+# HELP gs1200_poe_power_draw_watts Power drawn by PoE ports.
+# TYPE gs1200_poe_power_draw_watts gauge
+gs1200_poe_power_draw_watts 16.8
+# HELP gs1200_poe_power_remaining_watts Power left in the PoE budget.
+# TYPE gs1200_poe_power_remaining_watts gauge
+gs1200_poe_power_remaining_watts 43.2
+# HELP gs1200_poe_led_threshold_watts PoE draw above which the switch's PoE LED lights up.
+# TYPE gs1200_poe_led_threshold_watts gauge
+gs1200_poe_led_threshold_watts 50
+# HELP gs1200_port_poe_delivering Whether the port delivers power.
+# TYPE gs1200_port_poe_delivering gauge
+gs1200_port_poe_delivering{port="port 1"} 1
+gs1200_port_poe_delivering{port="port 2"} 1
+gs1200_port_poe_delivering{port="port 3"} 1
+gs1200_port_poe_delivering{port="port 4"} 0
+`
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(want),
+		"gs1200_poe_power_budget_watts", "gs1200_poe_power_draw_watts",
+		"gs1200_poe_power_remaining_watts", "gs1200_poe_led_threshold_watts",
+		"gs1200_port_poe_delivering"); err != nil {
+		t.Errorf("Exporter.Collect() %v", err)
+	}
+}
+
+func TestExporter_ParseErrors(t *testing.T) {
+	server := httptest.NewServer(samples.Rewrite(samples.Default, "link_data.js", "'Up','Down'", "'Up'"))
+	// Close the server when test finishes
+	defer server.Close()
+
+	collector, _ := GS1200Collector(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM", DefaultModule)
+	exporter := GS1200Exporter(t.Context(), collector)
+	want := `
+# HELP gs1200_parse_errors_total Number of times a field of the switch's data could not be parsed, and was left out.
+# TYPE gs1200_parse_errors_total counter
+gs1200_parse_errors_total{field="portstatus"} 1
+# HELP gs1200_up Whether the last scrape of the switch succeeded.
+# TYPE gs1200_up gauge
+gs1200_up 1
+`
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(want),
+		"gs1200_parse_errors_total", "gs1200_up"); err != nil {
+		t.Errorf("Exporter.Collect() %v", err)
+	}
+	if got := testutil.CollectAndCount(exporter, "gs1200_port_up"); got != 7 {
+		t.Errorf("Exporter.Collect() = %d gs1200_port_up, want 7", got)
+	}
+}
+
+func TestExporter_StatsColumns(t *testing.T) {
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+
+	collector, _ := GS1200Collector(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM", DefaultModule)
+	exporter := GS1200Exporter(t.Context(), collector)
+	// Five columns for each of the eight ports.
+	if got := testutil.CollectAndCount(exporter, "gs1200_port_stats_column_total"); got != 40 {
+		t.Errorf("Exporter.Collect() = %d gs1200_port_stats_column_total, want 40", got)
+	}
+}
+
+func TestExporter_InvalidPoE(t *testing.T) {
+	server := httptest.NewServer(samples.Rewrite(samples.Default, "poe_data.js", "var total_power = 60;", ""))
+	// Close the server when test finishes
+	defer server.Close()
+
+	// Without a budget, nothing is known to remain of it.
+	collector, _ := GS1200Collector(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM", DefaultModule)
+	exporter := GS1200Exporter(t.Context(), collector)
+	want := `
+# HELP gs1200_parse_errors_total Number of times a field of the switch's data could not be parsed, and was left out.
+# TYPE gs1200_parse_errors_total counter
+gs1200_parse_errors_total{field="total_power"} 1
+# HELP gs1200_poe_power_draw_watts Power drawn by PoE ports.
+# TYPE gs1200_poe_power_draw_watts gauge
+gs1200_poe_power_draw_watts 16.8
+`
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(want),
+		"gs1200_parse_errors_total", "gs1200_poe_power_draw_watts",
+		"gs1200_poe_power_budget_watts", "gs1200_poe_power_remaining_watts"); err != nil {
+		t.Errorf("Exporter.Collect() %v", err)
+	}
+}
+
+func TestExporter_Settings(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace []string
+		want    string
+	}{
+		{
+			name: "disabled",
+			want: `
+# HELP gs1200_settings_info Network and device settings of the switch, always 1.
+# TYPE gs1200_settings_info gauge
+gs1200_settings_info{device_name="GS1200-8HP v2",gateway="192.168.1.1",subnet_mask="255.255.255.0"} 1
+# HELP gs1200_dhcp_enabled Whether the switch gets its IP address by DHCP.
+# TYPE gs1200_dhcp_enabled gauge
+gs1200_dhcp_enabled 0
+# HELP gs1200_eee_enabled Whether Energy Efficient Ethernet is enabled.
+# TYPE gs1200_eee_enabled gauge
+gs1200_eee_enabled 0
+# HELP gs1200_led_state LED setting of the switch, as it serves it.
+# TYPE gs1200_led_state gauge
+gs1200_led_state 0
+# HELP gs1200_first_login_pending Whether the switch still awaits its first login, which sets the password.
+# TYPE gs1200_first_login_pending gauge
+gs1200_first_login_pending 0
+`,
+		},
+		{
+			name: "enabled",
+			replace: []string{
+				"var sys_dhcp_state = '0';", "var sys_dhcp_state = '1';",
+				"var sys_eee_state = '0';", "var sys_eee_state = '1';",
+				"var sys_led_state = '0';", "var sys_led_state = '1';",
+			},
+			want: `
+# HELP gs1200_settings_info Network and device settings of the switch, always 1.
+# TYPE gs1200_settings_info gauge
+gs1200_settings_info{device_name="GS1200-8HP v2",gateway="192.168.1.1",subnet_mask="255.255.255.0"} 1
+# HELP gs1200_dhcp_enabled Whether the switch gets its IP address by DHCP.
+# TYPE gs1200_dhcp_enabled gauge
+gs1200_dhcp_enabled 1
+# HELP gs1200_eee_enabled Whether Energy Efficient Ethernet is enabled.
+# TYPE gs1200_eee_enabled gauge
+gs1200_eee_enabled 1
+# HELP gs1200_led_state LED setting of the switch, as it serves it.
+# TYPE gs1200_led_state gauge
+gs1200_led_state 1
+# HELP gs1200_first_login_pending Whether the switch still awaits its first login, which sets the password.
+# TYPE gs1200_first_login_pending gauge
+gs1200_first_login_pending 0
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(samples.Rewrite(samples.Default, "system_data.js", tt.replace...))
+			// Close the server when test finishes
+			defer server.Close()
+
+			collector, _ := GS1200Collector(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM", DefaultModule)
+			exporter := GS1200Exporter(t.Context(), collector)
+			if err := testutil.CollectAndCompare(exporter, strings.NewReader(tt.want),
+				"gs1200_settings_info", "gs1200_dhcp_enabled", "gs1200_eee_enabled",
+				"gs1200_led_state", "gs1200_first_login_pending"); err != nil {
+				t.Errorf("Exporter.Collect() %v", err)
+			}
+		})
+	}
+}
+
+func TestExporter_Trunks(t *testing.T) {
+	// Ports 1 and 5 in the first trunk group.
+	server := httptest.NewServer(samples.Rewrite(samples.Default, "system_data.js", "var isTrunk0 = 0;", "var isTrunk0 = '0x11';"))
+	// Close the server when test finishes
+	defer server.Close()
+
+	collector, _ := GS1200Collector(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM", DefaultModule)
+	exporter := GS1200Exporter(t.Context(), collector)
+	want := `
+# HELP gs1200_trunk_member Port in a trunk group, always 1.
+# TYPE gs1200_trunk_member gauge
+gs1200_trunk_member{port="port 1",trunk="trunk 1"} 1
+gs1200_trunk_member{port="port 5",trunk="trunk 1"} 1
+# HELP gs1200_trunk_up Whether the link of any of the trunk's ports is up.
+# TYPE gs1200_trunk_up gauge
+gs1200_trunk_up{trunk="trunk 1"} 1
+# HELP gs1200_trunk_ports_up Number of the trunk's ports with their link up.
+# TYPE gs1200_trunk_ports_up gauge
+gs1200_trunk_ports_up{trunk="trunk 1"} 2
+# HELP gs1200_trunk_speed_bits_per_second Summed speed of the trunk's ports.
+# TYPE gs1200_trunk_speed_bits_per_second gauge
+gs1200_trunk_speed_bits_per_second{trunk="trunk 1"} 2e+09
+# HELP gs1200_trunk_packets_total Number of packets of the trunk's ports, as totalled by the web interface.
+# TYPE gs1200_trunk_packets_total counter
+gs1200_trunk_packets_total{direction="rx",trunk="trunk 1"} 5471
+gs1200_trunk_packets_total{direction="tx",trunk="trunk 1"} 5507
+`
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(want),
+		"gs1200_trunk_member", "gs1200_trunk_up", "gs1200_trunk_ports_up",
+		"gs1200_trunk_speed_bits_per_second", "gs1200_trunk_packets_total"); err != nil {
+		t.Errorf("Exporter.Collect() %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/robinelfrink/gs1200-exporter/pkg/gs1200"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Which metrics are reported, while dashboards move from the metrics of
+// earlier versions to the current ones.
+const (
+	// Only the current metrics.
+	LegacyOff = "off"
+	// The legacy metrics next to the current ones.
+	LegacyAlongside = "alongside"
+	// Only the legacy metrics.
+	LegacyOnly = "only"
+)
+
+// The metrics of earlier versions, kept as they were.
+var (
+	legacy_num_ports_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "num_ports"),
+		"Number of ports. Mainly a placeholder for system information.",
+		[]string{"model", "firmware", "ip", "mac", "loop"}, nil)
+	legacy_num_vlans_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "num_vlans"),
+		"Number of configured vlans.",
+		[]string{"vlans"}, nil)
+	legacy_speed_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "speed"),
+		"Port speed.",
+		[]string{"port", "status", "loop", "pvlan", "vlans", "unit", "duplex"}, nil)
+	legacy_tx_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "packets_tx"),
+		"Number of packets transmitted.",
+		[]string{"port"}, nil)
+	legacy_rx_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "packets_rx"),
+		"Number of packets received.",
+		[]string{"port"}, nil)
+	legacy_power_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "power"),
+		"Power usage in Watts.",
+		[]string{"port"}, nil)
+	legacy_max_power_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "max_power"),
+		"Maximum power available to PoE ports in Watts.",
+		[]string{"led"}, nil)
+)
+
+// ValidLegacy reports whether mode is a known legacy metrics mode.
+func ValidLegacy(mode string) bool {
+	switch mode {
+	case LegacyOff, LegacyAlongside, LegacyOnly:
+		return true
+	}
+	return false
+}
+
+func describeLegacy(ch chan<- *prometheus.Desc) {
+	ch <- legacy_num_ports_metric
+	ch <- legacy_num_vlans_metric
+	ch <- legacy_speed_metric
+	ch <- legacy_tx_metric
+	ch <- legacy_rx_metric
+	ch <- legacy_power_metric
+	ch <- legacy_max_power_metric
+}
+
+// collectLegacy reports the switch's data as earlier versions did.
+func collectLegacy(ch chan<- prometheus.Metric, systemData *gs1200.SystemData, portData []gs1200.PortData) {
+	ch <- prometheus.MustNewConstMetric(legacy_num_ports_metric, prometheus.GaugeValue,
+		float64(systemData.MaxPort), systemData.Model, systemData.Firmware,
+		systemData.IP, systemData.MAC, systemData.Loop)
+	ch <- prometheus.MustNewConstMetric(legacy_num_vlans_metric, prometheus.GaugeValue,
+		float64(len(systemData.VLANs)), strings.Join(systemData.VLANs, ","))
+	if systemData.TotalPower != nil && systemData.MaxLEDPower != nil {
+		ch <- prometheus.MustNewConstMetric(legacy_max_power_metric, prometheus.GaugeValue,
+			float64(*systemData.TotalPower), strconv.Itoa(*systemData.MaxLEDPower))
+	}
+
+	for i, port := range portData {
+		ch <- prometheus.MustNewConstMetric(legacy_speed_metric, prometheus.GaugeValue,
+			float64(port.Speed), port.Name, port.Status, port.LoopStatus,
+			port.PVLAN, strings.Join(port.VLANs, ","), port.SpeedUnit, port.Duplex)
+		ch <- prometheus.MustNewConstMetric(legacy_rx_metric, prometheus.GaugeValue,
+			port.Stats.RX, port.Name)
+		ch <- prometheus.MustNewConstMetric(legacy_tx_metric, prometheus.GaugeValue,
+			port.Stats.TX, port.Name)
+		if i < systemData.PoEPorts {
+			ch <- prometheus.MustNewConstMetric(legacy_power_metric, prometheus.GaugeValue,
+				port.Stats.Power, port.Name)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Package samples holds javascript files as served by a GS1200, and serves
+// them through the simulator as a fake switch, for use in tests. Every
+// directory is a fixture, holding the files of a single model and firmware,
+// captured from a real switch.
+package samples
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"testing/fstest"
+
+	"github.com/robinelfrink/gs1200-exporter/internal/simulator"
+)
+
+//go:embed */*.js
+var FS embed.FS
+
+// Default is the fixture most tests are served, captured from a
+// GS1200-8HP v2 with firmware V2.00(ABME.3)C0.
+const Default = "gs1200-8hp-v2"
+
+// Fixtures returns the names of all fixtures.
+func Fixtures() []string {
+	entries, _ := fs.ReadDir(FS, ".")
+	fixtures := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			fixtures = append(fixtures, entry.Name())
+		}
+	}
+	return fixtures
+}
+
+// TestingHandler returns a fake switch serving fixture, accepting the password
+// OFcVQl1shaUM.
+func TestingHandler(fixture string) http.Handler {
+	files, _ := fs.Sub(FS, fixture)
+	return simulator.New(simulator.Config{
+		Password: "OFcVQl1shaUM",
+		Files:    files,
+	})
+}
+
+// Rewrite returns a fake switch like TestingHandler, serving fixture with file
+// rewritten: the first occurrence of every old string in oldnew is replaced
+// by the new string following it. An empty old string puts the new one in
+// front of the file.
+func Rewrite(fixture string, file string, oldnew ...string) http.Handler {
+	files := fstest.MapFS{}
+	entries, _ := fs.ReadDir(FS, fixture)
+	for _, entry := range entries {
+		data, _ := FS.ReadFile(path.Join(fixture, entry.Name()))
+		files[entry.Name()] = &fstest.MapFile{Data: data}
+	}
+	js, _ := FS.ReadFile(path.Join(fixture, file))
+	rewritten := string(js)
+	for i := 0; i+1 < len(oldnew); i += 2 {
+		rewritten = strings.Replace(rewritten, oldnew[i], oldnew[i+1], 1)
+	}
+	files[file] = &fstest.MapFile{Data: []byte(rewritten)}
+	return simulator.New(simulator.Config{
+		Password: "OFcVQl1shaUM",
+		Files:    files,
+	})
+}
@@ -0,0 +1,342 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/robinelfrink/gs1200-exporter/pkg/gs1200"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultModule = "default"
+
+	// Time left to Prometheus for receiving the response, after the scrape
+	// of the switch gave up.
+	scrapeTimeoutOffset = 500 * time.Millisecond
+)
+
+type Server struct {
+	// Legacy selects whether the metrics of earlier versions are reported,
+	// one of LegacyOff, LegacyAlongside and LegacyOnly.
+	Legacy string
+	// Engine reading the switch's javascript files, one of
+	// gs1200.EngineLiteral and gs1200.EngineOtto.
+	Engine string
+	// Source of the switches' data, SourceSwitch or a directory prefixed
+	// by SourceDirPrefix.
+	Source string
+	// ProbeUnconfigured allows /probe to scrape targets that are not
+	// configured, sending them the password given on the command line.
+	ProbeUnconfigured bool
+
+	port     string
+	password string
+	config   *Config
+
+	// Collectors are kept, so that their sessions can be reused and their
+	// counters and what each switch serves survive between scrapes.
+	// Collectors of configured switches are kept by name, those of other
+	// probed targets by address.
+	mu         sync.Mutex
+	collectors map[string]*Collector
+	probed     map[string]*probe
+}
+
+// The collectors of probed targets that are not configured are dropped when
+// not probed for probedTTL. At most maxProbed are kept, dropping the least
+// recently probed, as anybody can make up targets.
+const (
+	probedTTL = 10 * time.Minute
+	maxProbed = 64
+)
+
+// probe is the collector of a target that is not configured.
+type probe struct {
+	collector *Collector
+	lastUsed  time.Time
+}
+
+// GS1200Server serves the switches in config. The password is used for probes
+// of targets that are not in config.
+func GS1200Server(config *Config, password string, port string) *Server {
+	return &Server{
+		Legacy:   LegacyOff,
+		Engine:   gs1200.EngineLiteral,
+		Source:   SourceSwitch,
+		port:     port,
+		password: password,
+		config:   config,
+
+		collectors: map[string]*Collector{},
+		probed:     map[string]*probe{},
+	}
+}
+
+// collector returns the collector for a configured switch, creating it on
+// first use. A switch has a single collector, whatever module it is probed
+// with.
+func (s *Server) collector(sw *SwitchConfig) (*Collector, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sw.Name
+	if collector, ok := s.collectors[key]; ok {
+		return collector, nil
+	}
+	module, _ := s.config.Module(sw.Module)
+	collector, err := s.newCollector(sw.Address, sw.Password, module)
+	if err != nil {
+		return nil, err
+	}
+	collector.client.Engine = s.Engine
+	collector.client.KeepSession = sw.KeepSession
+	collector.onConflict = sw.OnConflict
+	if sw.OnConflict == ConflictRetry {
+		collector.client.ConflictRetry = sw.ConflictTimeout
+	}
+	collector.pollInterval = sw.PollInterval
+	if collector.Polling() {
+		collector.Poll()
+	}
+	s.collectors[key] = collector
+	return collector, nil
+}
+
+// probedCollector returns the collector for a target that is not configured,
+// creating it on first use.
+func (s *Server) probedCollector(target string) (*Collector, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.expire(now)
+	if p, ok := s.probed[target]; ok {
+		p.lastUsed = now
+		return p.collector, nil
+	}
+	collector, err := s.newCollector(target, s.password, DefaultModule)
+	if err != nil {
+		return nil, err
+	}
+	collector.client.Engine = s.Engine
+	if len(s.probed) >= maxProbed {
+		s.evict()
+	}
+	s.probed[target] = &probe{collector: collector, lastUsed: now}
+	return collector, nil
+}
+
+// expire drops the collectors of targets not probed for probedTTL.
+func (s *Server) expire(now time.Time) {
+	for target, p := range s.probed {
+		if now.Sub(p.lastUsed) > probedTTL {
+			s.drop(target)
+		}
+	}
+}
+
+// evict drops the collector of the least recently probed target.
+func (s *Server) evict() {
+	oldest := ""
+	for target, p := range s.probed {
+		if oldest == "" || p.lastUsed.Before(s.probed[oldest].lastUsed) {
+			oldest = target
+		}
+	}
+	s.drop(oldest)
+}
+
+// drop forgets the collector of target. It is closed in the background, as
+// a probe may still be using it.
+func (s *Server) drop(target string) {
+	log.Debug("Dropping collector of ", target)
+	go s.probed[target].collector.Close()
+	delete(s.probed, target)
+}
+
+// newCollector returns a collector of the switch at address, reading from the
+// server's source.
+func (s *Server) newCollector(address string, password string, module Module) (*Collector, error) {
+	if dir, ok := strings.CutPrefix(s.Source, SourceDirPrefix); ok {
+		return ReplayCollector(address, dir, module)
+	}
+	return GS1200Collector(address, password, module)
+}
+
+// moduleSource scrapes a collector with a module other than its own.
+type moduleSource struct {
+	collector *Collector
+	module    Module
+}
+
+func (m moduleSource) Scrape(ctx context.Context) *Scrape {
+	return m.collector.ScrapeModule(ctx, m.module)
+}
+
+// exporter returns an exporter of source for a single request.
+func (s *Server) exporter(ctx context.Context, source Source) *Exporter {
+	exporter := GS1200Exporter(ctx, source)
+	exporter.legacy = s.Legacy
+	return exporter
+}
+
+// close ends all kept sessions.
+func (s *Server) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, collector := range s.collectors {
+		collector.Close()
+	}
+	for _, p := range s.probed {
+		p.collector.Close()
+	}
+}
+
+// register registers the exporters of all configured switches, bound to ctx.
+func (s *Server) register(ctx context.Context, registerer prometheus.Registerer) error {
+	for i := range s.config.Switches {
+		sw := &s.config.Switches[i]
+		collector, err := s.collector(sw)
+		if err != nil {
+			return fmt.Errorf("cannot start collector for %s: %w", sw.Name, err)
+		}
+		labels := prometheus.Labels{}
+		for name, value := range sw.Labels {
+			labels[name] = value
+		}
+		if s.config.targetLabel {
+			labels["target"] = sw.Name
+		}
+		wrapped := prometheus.WrapRegistererWith(labels, registerer)
+		if err := wrapped.Register(s.exporter(ctx, collector)); err != nil {
+			return fmt.Errorf("cannot register switch %s: %w", sw.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) Run() {
+	// Check the switches once at startup, rather than on every scrape.
+	if err := s.register(context.Background(), prometheus.NewRegistry()); err != nil {
+		log.Fatal(err)
+	}
+
+	http.HandleFunc("/metrics", s.Metrics)
+	http.HandleFunc("/probe", s.Probe)
+
+	// Log out of kept sessions on shutdown, so the switch's web interface is
+	// available right away.
+	server := &http.Server{Addr: ":" + s.port}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		log.Info("Shutting down")
+		_ = server.Shutdown(context.Background())
+	}()
+
+	log.Info("Listening for requests on port ", s.port)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	s.close()
+}
+
+// scrapeContext returns the context for scraping a switch for r. It ends a bit
+// before Prometheus gives up on the request, as told by the
+// X-Prometheus-Scrape-Timeout-Seconds header.
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return context.WithCancel(r.Context())
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		log.Warn("Invalid X-Prometheus-Scrape-Timeout-Seconds header: ", header)
+		return context.WithCancel(r.Context())
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > 2*scrapeTimeoutOffset {
+		timeout -= scrapeTimeoutOffset
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// Metrics handles /metrics, reporting all configured switches next to the
+// exporter's own metrics.
+func (s *Server) Metrics(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := scrapeContext(r)
+	defer cancel()
+	registry := prometheus.NewRegistry()
+	if err := s.register(ctx, registry); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+	promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// Probe handles a multi-target request like /probe?target=<host>&module=<name>.
+// Every target has a collector with its own cookie jar and session, so
+// concurrent probes of different switches do not clash. Targets are configured
+// switches, by name or address. Other addresses are refused, unless
+// ProbeUnconfigured is set, as probing them sends them the password.
+func (s *Server) Probe(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "'target' parameter must be specified", http.StatusBadRequest)
+		return
+	}
+	sw := s.config.Switch(target)
+	if sw == nil && !s.ProbeUnconfigured {
+		http.Error(w, "Unknown target '"+target+"'", http.StatusForbidden)
+		return
+	}
+	moduleName, labels := defaultModule, map[string]string{}
+	if sw != nil {
+		moduleName, labels = sw.Module, sw.Labels
+	}
+	if r.URL.Query().Get("module") != "" {
+		moduleName = r.URL.Query().Get("module")
+	}
+	module, ok := s.config.Module(moduleName)
+	if !ok {
+		http.Error(w, "Unknown module '"+moduleName+"'", http.StatusBadRequest)
+		return
+	}
+
+	log.Debug("Probing ", target, " with module ", moduleName)
+	var collector *Collector
+	var err error
+	if sw != nil {
+		collector, err = s.collector(sw)
+	} else {
+		collector, err = s.probedCollector(target)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := scrapeContext(r)
+	defer cancel()
+	registry := prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWith(labels, registry)
+	source := moduleSource{collector: collector, module: module}
+	if err := registerer.Register(s.exporter(ctx, source)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robinelfrink/gs1200-exporter/internal/samples"
+	"github.com/robinelfrink/gs1200-exporter/pkg/gs1200"
+)
+
+func TestServer_Probe(t *testing.T) {
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+
+	target := strings.Replace(server.URL, "http://", "", 1)
+	s := GS1200Server(&Config{
+		Switches: []SwitchConfig{{
+			Name:     "core",
+			Address:  target,
+			Password: "OFcVQl1shaUM",
+			Labels:   map[string]string{"site": "ams"},
+			Module:   "minimal",
+		}},
+		Modules: map[string]Module{
+			"minimal": {Pages: []string{gs1200.PageLink}},
+		},
+	}, "OFcVQl1shaUM", "9934")
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		match  string
+		absent string
+	}{
+		{
+			name:   "missing target",
+			query:  "",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unconfigured target",
+			query:  "target=192.0.2.1",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "unknown module",
+			query:  "target=" + target + "&module=world_peace",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "default module",
+			query:  "target=" + target,
+			status: http.StatusOK,
+			match:  `gs1200_info{firmware="V2.00(ABME.3)C0"`,
+		},
+		{
+			name:   "explicit module",
+			query:  "target=" + target + "&module=default",
+			status: http.StatusOK,
+			match:  `gs1200_port_speed_bits_per_second{port="port 5",site="ams"} 1e+09`,
+		},
+		{
+			name:   "configured switch",
+			query:  "target=core",
+			status: http.StatusOK,
+			match:  `gs1200_port_packets_total{direction="rx",port="port 1",site="ams"} 3337`,
+		},
+		{
+			name:   "port counters",
+			query:  "target=" + target,
+			status: http.StatusOK,
+			match:  `gs1200_port_unicast_packets_total{direction="tx",port="port 8",site="ams"} 835`,
+		},
+		{
+			name:   "vlan membership",
+			query:  "target=" + target + "&module=default",
+			status: http.StatusOK,
+			match:  `gs1200_vlan_port_member{mode="tagged",port="port 3",site="ams",vlan="51"} 1`,
+		},
+		{
+			name:   "port pvid",
+			query:  "target=core&module=default",
+			status: http.StatusOK,
+			match:  `gs1200_port_info{port="port 1",pvid="1",site="ams"} 1`,
+		},
+		{
+			name:   "configured module",
+			query:  "target=core",
+			status: http.StatusOK,
+			match:  `gs1200_port_up{port="port 1",site="ams"} 1`,
+			absent: "gs1200_port_info",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.Probe(rec, httptest.NewRequest(http.MethodGet, "/probe?"+tt.query, nil))
+			if rec.Code != tt.status {
+				t.Errorf("Server.Probe() status = %v, want %v", rec.Code, tt.status)
+				return
+			}
+			body, _ := io.ReadAll(rec.Body)
+			if tt.match != "" && !strings.Contains(string(body), tt.match) {
+				t.Errorf("Server.Probe() body does not contain %v", tt.match)
+			}
+			if tt.absent != "" && strings.Contains(string(body), tt.absent) {
+				t.Errorf("Server.Probe() body contains %v", tt.absent)
+			}
+		})
+	}
+	// Every module is probed through the one session with the switch.
+	if len(s.collectors) != 1 {
+		t.Errorf("Server.Probe() collectors = %v, want 1", len(s.collectors))
+	}
+}
+
+func TestServer_Replay(t *testing.T) {
+	s := GS1200Server(&Config{
+		Switches: []SwitchConfig{{
+			Name:    "core",
+			Address: "192.168.1.3",
+			Module:  defaultModule,
+		}},
+	}, "", "9934")
+	s.Source = SourceDirPrefix + "samples/" + samples.Default
+	s.ProbeUnconfigured = true
+	defer s.close()
+
+	// Configured or not, the capture is served.
+	for _, target := range []string{"core", "192.168.1.4"} {
+		rec := httptest.NewRecorder()
+		s.Probe(rec, httptest.NewRequest(http.MethodGet, "/probe?target="+target, nil))
+		body, _ := io.ReadAll(rec.Body)
+		match := `gs1200_info{firmware="V2.00(ABME.3)C0",ip="192.168.1.3"`
+		if rec.Code != http.StatusOK || !strings.Contains(string(body), match) {
+			t.Errorf("Server.Probe(%v) = %v, body does not contain %v", target, rec.Code, match)
+		}
+	}
+}
+
+func TestServer_ProbeUnconfigured(t *testing.T) {
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+
+	target := strings.Replace(server.URL, "http://", "", 1)
+	s := GS1200Server(&Config{}, "wrong", "9934")
+	s.ProbeUnconfigured = true
+	defer s.close()
+
+	// The collector of the target is kept, so its counters keep counting.
+	match := `gs1200_scrape_errors_total{phase="login",reason="incorrect_password"} 2`
+	var body []byte
+	for range 2 {
+		rec := httptest.NewRecorder()
+		s.Probe(rec, httptest.NewRequest(http.MethodGet, "/probe?target="+target, nil))
+		body, _ = io.ReadAll(rec.Body)
+	}
+	if !strings.Contains(string(body), match) {
+		t.Errorf("Server.Probe() body does not contain %v", match)
+	}
+}
+
+func TestServer_ProbedBounded(t *testing.T) {
+	s := GS1200Server(&Config{}, "", "9934")
+	s.Source = SourceDirPrefix + "samples/" + samples.Default
+	s.ProbeUnconfigured = true
+	defer s.close()
+
+	probe := func(target string) {
+		rec := httptest.NewRecorder()
+		s.Probe(rec, httptest.NewRequest(http.MethodGet, "/probe?target="+target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Server.Probe(%v) status = %v", target, rec.Code)
+		}
+	}
+
+	// Made up targets push out the least recently probed.
+	for i := 0; i <= maxProbed; i++ {
+		probe("192.0.2." + strconv.Itoa(i))
+	}
+	if len(s.probed) != maxProbed || s.probed["192.0.2.0"] != nil {
+		t.Errorf("Server.Probe() kept %v collectors, want %v without the first", len(s.probed), maxProbed)
+	}
+
+	// Targets not probed for a while are dropped.
+	s.mu.Lock()
+	for _, p := range s.probed {
+		p.lastUsed = p.lastUsed.Add(-probedTTL - time.Second)
+	}
+	s.mu.Unlock()
+	probe("192.0.2.1")
+	if len(s.probed) != 1 {
+		t.Errorf("Server.Probe() kept %v collectors, want 1", len(s.probed))
+	}
+}
+
+func TestScrapeContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		timeout time.Duration
+	}{
+		{
+			name:    "no header",
+			header:  "",
+			timeout: 0,
+		},
+		{
+			name:    "prometheus default",
+			header:  "10",
+			timeout: 9500 * time.Millisecond,
+		},
+		{
+			name:    "short timeout",
+			header:  "0.5",
+			timeout: 500 * time.Millisecond,
+		},
+		{
+			name:    "invalid header",
+			header:  "soon",
+			timeout: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", tt.header)
+			}
+			start := time.Now()
+			ctx, cancel := scrapeContext(r)
+			defer cancel()
+			deadline, ok := ctx.Deadline()
+			if ok != (tt.timeout > 0) {
+				t.Fatalf("scrapeContext() deadline = %v, want %v", ok, tt.timeout > 0)
+			}
+			if got := deadline.Sub(start).Round(100 * time.Millisecond); ok && got != tt.timeout {
+				t.Errorf("scrapeContext() timeout = %v, want %v", got, tt.timeout)
+			}
+		})
+	}
+}
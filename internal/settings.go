@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"github.com/robinelfrink/gs1200-exporter/pkg/gs1200"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The switch's network and device settings.
+var (
+	settings_info_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "settings_info"),
+		"Network and device settings of the switch, always 1.",
+		[]string{"device_name", "subnet_mask", "gateway"}, nil)
+	dhcp_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "dhcp_enabled"),
+		"Whether the switch gets its IP address by DHCP.",
+		nil, nil)
+	eee_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "eee_enabled"),
+		"Whether Energy Efficient Ethernet is enabled.",
+		nil, nil)
+	led_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "led_state"),
+		"LED setting of the switch, as it serves it.",
+		nil, nil)
+	first_login_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "first_login_pending"),
+		"Whether the switch still awaits its first login, which sets the password.",
+		nil, nil)
+)
+
+func describeSettings(ch chan<- *prometheus.Desc) {
+	ch <- settings_info_metric
+	ch <- dhcp_metric
+	ch <- eee_metric
+	ch <- led_metric
+	ch <- first_login_metric
+}
+
+// collectSettings reports the switch's settings, leaving out the ones that
+// could not be parsed.
+func collectSettings(ch chan<- prometheus.Metric, settings gs1200.Settings) {
+	ch <- prometheus.MustNewConstMetric(settings_info_metric, prometheus.GaugeValue,
+		1, settings.DeviceName, settings.SubnetMask, settings.Gateway)
+	if settings.DHCP != nil {
+		ch <- prometheus.MustNewConstMetric(dhcp_metric, prometheus.GaugeValue,
+			boolValue(*settings.DHCP))
+	}
+	if settings.EEE != nil {
+		ch <- prometheus.MustNewConstMetric(eee_metric, prometheus.GaugeValue,
+			boolValue(*settings.EEE))
+	}
+	if settings.LED != nil {
+		ch <- prometheus.MustNewConstMetric(led_metric, prometheus.GaugeValue,
+			float64(*settings.LED))
+	}
+	if settings.FirstLogin != nil {
+		ch <- prometheus.MustNewConstMetric(first_login_metric, prometheus.GaugeValue,
+			boolValue(*settings.FirstLogin))
+	}
+}
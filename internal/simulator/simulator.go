@@ -0,0 +1,323 @@
+// Package simulator is a fake GS1200 switch, for demos and for testing
+// without a switch. It serves the switch's javascript files with counters
+// that keep increasing, or files captured from a switch, and can be told to
+// misbehave.
+package simulator
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Config describes the simulated switch.
+type Config struct {
+	Password string
+	// Number of ports, usually 5 or 8.
+	Ports int
+	// Number of ports with PoE, counting from the first port. Zero
+	// simulates a switch without PoE.
+	PoEPorts int
+	// Files, when set, are served as they are instead of generated ones,
+	// like the captured files of a real switch.
+	Files  fs.FS
+	Faults Faults
+}
+
+// Faults make the simulated switch misbehave. The rates are fractions of the
+// requests, between 0 and 1.
+type Faults struct {
+	// Delay of every response.
+	Delay time.Duration
+	// Rate of requests answered with 500 Internal Server Error.
+	ErrorRate float64
+	// Rate of javascript files cut off halfway.
+	TruncateRate float64
+	// Rate of logins refused as if somebody else is logged in.
+	ConflictRate float64
+}
+
+const (
+	// The session timeout, in minutes, as served in http_timeout_time.
+	sessionTimeout = 5
+	sessionCookie  = "session"
+)
+
+// The pages the switch serves to a browser instead of data.
+const (
+	loginPage     = "<html><head><title>GS1200</title></head><body>Login</body></html>"
+	passwordPage  = "<html><head><title>Message</title></head><script>alert(\"Incorrect password, please try again.\");</script></html>"
+	loggedInPage  = "<html><head><title>Message</title></head><body>If a user is logged in already, please try again later.</body></html>"
+	loggedOutPage = "<html><head><title>GS1200</title></head><body>Logged out</body></html>"
+)
+
+// Simulator is an http.Handler acting as a switch.
+type Simulator struct {
+	config Config
+	start  time.Time
+
+	mu       sync.Mutex
+	session  string
+	lastUsed time.Time
+}
+
+func New(config Config) *Simulator {
+	return &Simulator{
+		config: config,
+		start:  time.Now(),
+	}
+}
+
+// Model returns the model name the simulator serves, like GS1200-8HP v2.
+func (s *Simulator) Model() string {
+	model := "GS1200-" + strconv.Itoa(s.config.Ports)
+	if s.config.PoEPorts > 0 {
+		model += "HP v2"
+	}
+	return model
+}
+
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	faults := s.config.Faults
+	if faults.Delay > 0 {
+		select {
+		case <-time.After(faults.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if faults.ErrorRate > 0 && mathrand.Float64() < faults.ErrorRate {
+		log.Debug("Simulating an error for ", r.URL.Path)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/login.cgi":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.login(w, r)
+	case "/logout.html":
+		s.logout(r)
+		_, _ = w.Write([]byte(loggedOutPage))
+	default:
+		file := strings.TrimPrefix(r.URL.Path, "/")
+		js, ok := s.file(file)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		// Without a session the switch serves its login page.
+		if !s.authorized(r) {
+			_, _ = w.Write([]byte(loginPage))
+			return
+		}
+		if faults.TruncateRate > 0 && mathrand.Float64() < faults.TruncateRate {
+			log.Debug("Simulating a truncated ", file)
+			js = js[:len(js)/2]
+		}
+		w.Header().Set("Content-Type", "application/javascript")
+		_, _ = w.Write([]byte(js))
+	}
+}
+
+// login starts a session, unless somebody else has one.
+func (s *Simulator) login(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.Faults.ConflictRate > 0 && mathrand.Float64() < s.config.Faults.ConflictRate ||
+		s.active() && !s.owns(r) {
+		_, _ = w.Write([]byte(loggedInPage))
+		return
+	}
+	// A failed login still answers 200 OK, like the switch does.
+	if decryptPassword(r.Form.Get("password")) != s.config.Password {
+		_, _ = w.Write([]byte(passwordPage))
+		return
+	}
+	session := make([]byte, 16)
+	_, _ = rand.Read(session)
+	s.session, s.lastUsed = hex.EncodeToString(session), time.Now()
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: s.session, Path: "/"})
+	_, _ = w.Write([]byte(loginPage))
+}
+
+// decryptPassword reverses the obfuscation of the password in the login form,
+// like the switch does.
+func decryptPassword(encrypted string) string {
+	result := []byte{}
+	for i := 1; i < len(encrypted); i = i + 2 {
+		result = append(result, byte(int(encrypted[i])+(len(encrypted)/2)))
+	}
+	return string(result)
+}
+
+func (s *Simulator) logout(r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.owns(r) {
+		s.session = ""
+	}
+}
+
+// authorized reports whether r belongs to the active session, and keeps the
+// session alive.
+func (s *Simulator) authorized(r *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.active() || !s.owns(r) {
+		return false
+	}
+	s.lastUsed = time.Now()
+	return true
+}
+
+// active reports whether a session has not expired yet.
+func (s *Simulator) active() bool {
+	return s.session != "" && time.Since(s.lastUsed) < sessionTimeout*time.Minute
+}
+
+func (s *Simulator) owns(r *http.Request) bool {
+	cookie, err := r.Cookie(sessionCookie)
+	return err == nil && s.session != "" && cookie.Value == s.session
+}
+
+// file returns the contents of a javascript file, as of now.
+func (s *Simulator) file(name string) (string, bool) {
+	if s.config.Files != nil {
+		data, err := fs.ReadFile(s.config.Files, name)
+		return string(data), err == nil
+	}
+	switch name {
+	case "system_data.js":
+		return s.systemData(), true
+	case "link_data.js":
+		return s.linkData(), true
+	case "VLAN_1Q_List_data.js":
+		return s.vlanData(), true
+	case "poe_data.js":
+		if s.config.PoEPorts > 0 {
+			return s.poeData(), true
+		}
+	}
+	return "", false
+}
+
+// up reports whether the link of a port, counting from 0, is up. Every other
+// port is.
+func up(port int) bool {
+	return port%2 == 0
+}
+
+// list formats values as a javascript array.
+func list(values []string) string {
+	return "[" + strings.Join(values, ",") + "]"
+}
+
+func (s *Simulator) systemData() string {
+	loops := []string{}
+	// Like the switch, loop_status has entries for the trunks and CPU too.
+	for i := 0; i < s.config.Ports+3; i++ {
+		loops = append(loops, "'Normal'")
+	}
+	return fmt.Sprintf(`var Max_port = '%d';
+var model_name = '%s';
+var sys_dev_name = '%s';
+var sys_fmw_ver = 'V2.00(SIM.0)C0';
+var sys_bld_date = '2021.12.17';
+var sys_MAC = '02:00:00:00:00:01';
+var sys_IP = '192.0.2.1';
+var sys_sbnt_msk = '255.255.255.0';
+var sys_gateway = '192.0.2.254';
+var sys_dhcp_state = '0';
+var sys_first_login = '0';
+var system_uptime = '%d';
+var loop = 'Normal';
+var loop_status = %s;
+var logined = '1';
+var isTrunk0 = 0;
+var isTrunk1 = 0;
+var sys_eee_state = '0';
+var sys_led_state = '0';
+var http_timeout_time = '%d';
+`, s.config.Ports, s.Model(), s.Model(), int(time.Since(s.start).Seconds()), list(loops), sessionTimeout)
+}
+
+func (s *Simulator) linkData() string {
+	elapsed := time.Since(s.start).Seconds()
+	status, speed, stats := []string{}, []string{}, []string{}
+	for i := 0; i < s.config.Ports; i++ {
+		if !up(i) {
+			status = append(status, "'Down'")
+			speed = append(speed, "'0 Mbps'")
+			stats = append(stats, "['0',0,0,0,'0','0',0,0,0,'0',0]")
+			continue
+		}
+		status = append(status, "'Up'")
+		speed = append(speed, "'1000 Mbps Full'")
+		// Every port has its own steady traffic. The columns whose meaning
+		// is not known grow along with it.
+		tx := int64(elapsed * float64(100*(i+1)))
+		rx := int64(elapsed * float64(150*(i+1)))
+		multicast, broadcast := tx/100, rx/50
+		stats = append(stats, fmt.Sprintf("['%d',%d,%d,%d,'0','%d',%d,%d,%d,'0',%d]",
+			64*(tx+multicast), tx, multicast, 0, 64*(rx+broadcast), rx, 0, broadcast, rx/10000))
+	}
+	return fmt.Sprintf(`var portstatus = %s;
+var speed = %s;
+var Stats = [
+%s];
+`, list(status), list(speed), strings.Join(stats, ",\n"))
+}
+
+func (s *Simulator) vlanData() string {
+	pvids := []string{}
+	// Like the switch, pvids has entries for the trunks too.
+	for i := 0; i < s.config.Ports+2; i++ {
+		pvids = append(pvids, "1")
+	}
+	mask := fmt.Sprintf("0x%X", 1<<s.config.Ports-1)
+	return fmt.Sprintf(`var isTrunkGroupOne = 0;
+var isTrunkGroupTwo = 0;
+var pvids = %s;
+var port_nums = %d;
+var qvlans = [
+['1', '%s','0x0']
+];
+`, list(pvids), s.config.Ports, mask)
+}
+
+func (s *Simulator) poeData() string {
+	power := []string{}
+	total := 0.0
+	for i := 0; i < s.config.PoEPorts; i++ {
+		watts := 0.0
+		if up(i) {
+			watts = 4.5 + float64(i)/2
+		}
+		total += watts
+		power = append(power, strconv.FormatFloat(watts, 'f', 1, 64))
+	}
+	budget := 15 * s.config.PoEPorts
+	return fmt.Sprintf(`var total_power = %d;
+var max_led_power = %d;
+var port_power = %s;
+var total_real_power = %.1f;
+`, budget, budget*5/6, list(power), total)
+}
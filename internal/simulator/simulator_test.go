@@ -0,0 +1,146 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robinelfrink/gs1200-exporter/pkg/gs1200"
+)
+
+func TestSimulator_Collect(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports int
+		poe   int
+		model string
+	}{
+		{
+			name:  "poe",
+			ports: 8,
+			poe:   4,
+			model: "GS1200-8HP v2",
+		},
+		{
+			name:  "no poe",
+			ports: 5,
+			poe:   0,
+			model: "GS1200-5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator := New(Config{Password: "secret", Ports: tt.ports, PoEPorts: tt.poe})
+			simulator.start = time.Now().Add(-time.Hour)
+			server := httptest.NewServer(simulator)
+			// Close the server when test finishes
+			defer server.Close()
+
+			c, _ := gs1200.NewClient(strings.Replace(server.URL, "http://", "", 1), "secret")
+			s, p, err := c.Collect(t.Context(), nil)
+			if err != nil {
+				t.Fatalf("Client.Collect() error = %v", err)
+			}
+			if s.Model != tt.model || len(p) != tt.ports || s.PoEPorts != tt.poe || len(s.ParseErrors) > 0 {
+				t.Errorf("Client.Collect() = %v with %d ports and %d PoE ports, parse errors %v",
+					s.Model, len(p), s.PoEPorts, s.ParseErrors)
+			}
+			if s.Uptime < time.Hour || p[0].Status != "Up" || p[1].Status != "Down" {
+				t.Errorf("Client.Collect() uptime = %v, port 1 %v, port 2 %v", s.Uptime, p[0].Status, p[1].Status)
+			}
+
+			// The counters keep increasing.
+			time.Sleep(50 * time.Millisecond)
+			_, next, err := c.Collect(t.Context(), nil)
+			if err != nil {
+				t.Fatalf("Client.Collect() error = %v", err)
+			}
+			if next[0].Stats.RX <= p[0].Stats.RX || next[0].Stats.TXCounters.Unicast <= p[0].Stats.TXCounters.Unicast {
+				t.Errorf("Client.Collect() port 1 counters = %v, then %v", p[0].Stats, next[0].Stats)
+			}
+		})
+	}
+}
+
+func TestSimulator_Session(t *testing.T) {
+	server := httptest.NewServer(New(Config{Password: "secret", Ports: 8}))
+	// Close the server when test finishes
+	defer server.Close()
+	address := strings.Replace(server.URL, "http://", "", 1)
+
+	wrong, _ := gs1200.NewClient(address, "guess")
+	if err := wrong.Login(t.Context()); !errors.Is(err, gs1200.ErrIncorrectPassword) {
+		t.Errorf("Client.Login() error = %v, want %v", err, gs1200.ErrIncorrectPassword)
+	}
+
+	first, _ := gs1200.NewClient(address, "secret")
+	first.KeepSession = true
+	if _, _, err := first.Collect(t.Context(), nil); err != nil {
+		t.Fatalf("Client.Collect() error = %v", err)
+	}
+	second, _ := gs1200.NewClient(address, "secret")
+	if _, _, err := second.Collect(t.Context(), nil); !errors.Is(err, gs1200.ErrLoggedInElsewhere) {
+		t.Errorf("Client.Collect() error = %v, want %v", err, gs1200.ErrLoggedInElsewhere)
+	}
+
+	// Once the first session ends, the second client gets in.
+	first.Close()
+	if _, _, err := second.Collect(t.Context(), nil); err != nil {
+		t.Errorf("Client.Collect() error = %v", err)
+	}
+}
+
+func TestSimulator_Faults(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults Faults
+		err    error
+		phase  string
+	}{
+		{
+			name:   "errors",
+			faults: Faults{ErrorRate: 1},
+			err:    gs1200.ErrUnexpectedStatus,
+			phase:  gs1200.PhaseLogin,
+		},
+		{
+			name:   "truncated",
+			faults: Faults{TruncateRate: 1},
+			phase:  gs1200.PhaseDiscover,
+		},
+		{
+			name:   "conflict",
+			faults: Faults{ConflictRate: 1},
+			err:    gs1200.ErrLoggedInElsewhere,
+			phase:  gs1200.PhaseLogin,
+		},
+		{
+			name:   "slow",
+			faults: Faults{Delay: time.Second},
+			err:    context.DeadlineExceeded,
+			phase:  gs1200.PhaseLogin,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(New(Config{Password: "secret", Ports: 8, PoEPorts: 4, Faults: tt.faults}))
+			// Close the server when test finishes
+			defer server.Close()
+
+			c, _ := gs1200.NewClient(strings.Replace(server.URL, "http://", "", 1), "secret")
+			ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+			defer cancel()
+			trace := &gs1200.Trace{}
+			_, _, err := c.Collect(ctx, trace)
+			if err == nil || tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Client.Collect() error = %v, want %v", err, tt.err)
+			}
+			if trace.FailedPhase != tt.phase {
+				t.Errorf("Client.Collect() failed phase = %v, want %v", trace.FailedPhase, tt.phase)
+			}
+		})
+	}
+}
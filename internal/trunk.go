@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"github.com/robinelfrink/gs1200-exporter/pkg/gs1200"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Trunk groups, reported as logical interfaces made up of their member ports.
+var (
+	trunk_member_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "trunk_member"),
+		"Port in a trunk group, always 1.",
+		[]string{"trunk", "port"}, nil)
+	trunk_up_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "trunk_up"),
+		"Whether the link of any of the trunk's ports is up.",
+		[]string{"trunk"}, nil)
+	trunk_ports_up_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "trunk_ports_up"),
+		"Number of the trunk's ports with their link up.",
+		[]string{"trunk"}, nil)
+	trunk_speed_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "trunk_speed_bits_per_second"),
+		"Summed speed of the trunk's ports.",
+		[]string{"trunk"}, nil)
+	trunk_packets_metric = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "trunk_packets_total"),
+		"Number of packets of the trunk's ports, as totalled by the web interface.",
+		[]string{"trunk", "direction"}, nil)
+)
+
+func describeTrunks(ch chan<- *prometheus.Desc) {
+	ch <- trunk_member_metric
+	ch <- trunk_up_metric
+	ch <- trunk_ports_up_metric
+	ch <- trunk_speed_metric
+	ch <- trunk_packets_metric
+}
+
+// collectTrunks reports the trunk groups. Their state and counters are those
+// of the member ports that were collected, summed.
+func collectTrunks(ch chan<- prometheus.Metric, trunks []gs1200.Trunk, portData []gs1200.PortData) {
+	ports := map[string]*gs1200.PortData{}
+	for i := range portData {
+		ports[portData[i].Name] = &portData[i]
+	}
+
+	for _, trunk := range trunks {
+		var up, speed float64
+		var stats gs1200.PortStats
+		collected := false
+		for _, name := range trunk.Ports {
+			ch <- prometheus.MustNewConstMetric(trunk_member_metric, prometheus.GaugeValue,
+				1, trunk.Name, name)
+			port, ok := ports[name]
+			if !ok {
+				continue
+			}
+			collected = true
+			if port.Status == "Up" {
+				up++
+			}
+			speed += port.BitsPerSecond()
+			stats.RX += port.Stats.RX
+			stats.TX += port.Stats.TX
+		}
+		// Without the link page there is nothing to sum.
+		if !collected {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(trunk_up_metric, prometheus.GaugeValue,
+			boolValue(up > 0), trunk.Name)
+		ch <- prometheus.MustNewConstMetric(trunk_ports_up_metric, prometheus.GaugeValue,
+			up, trunk.Name)
+		ch <- prometheus.MustNewConstMetric(trunk_speed_metric, prometheus.GaugeValue,
+			speed, trunk.Name)
+		ch <- prometheus.MustNewConstMetric(trunk_packets_metric, prometheus.CounterValue,
+			stats.RX, trunk.Name, "rx")
+		ch <- prometheus.MustNewConstMetric(trunk_packets_metric, prometheus.CounterValue,
+			stats.TX, trunk.Name, "tx")
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
-	gs1200 "gs1200-exporter/internal"
+	gs1200 "github.com/robinelfrink/gs1200-exporter/internal"
+	"github.com/robinelfrink/gs1200-exporter/internal/simulator"
+	gs1200lib "github.com/robinelfrink/gs1200-exporter/pkg/gs1200"
+	"net/http"
 	"os"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -17,6 +22,24 @@ var (
 		"IP address or hostname of the GS1200")
 	gs1200Password = flag.String("password", "********",
 		"Password to log on to the GS1200")
+	configFile = flag.String("config.file", "",
+		"Configuration file describing the switches to scrape")
+	keepSession = flag.Bool("session.keep", false,
+		"Keep the GS1200 session between scrapes")
+	onConflict = flag.String("conflict.policy", gs1200.ConflictFail,
+		"What to do when somebody else is logged in: fail, retry or yield")
+	conflictTimeout = flag.Duration("conflict.timeout", gs1200.DefaultConflictTimeout,
+		"How long to retry logging in when somebody else is logged in")
+	pollInterval = flag.Duration("poll.interval", 0,
+		"Poll the GS1200 in the background at this interval, instead of on every scrape")
+	metricsLegacy = flag.String("metrics.legacy", gs1200.LegacyOff,
+		"Report the metrics of earlier versions: off, alongside or only")
+	parserEngine = flag.String("parser.engine", gs1200lib.EngineLiteral,
+		"How to read the GS1200's javascript files: literal, or otto to run them")
+	source = flag.String("source", gs1200.SourceSwitch,
+		"Where to read the GS1200's data: switch, or dir:/path for files captured from it")
+	probeUnconfigured = flag.Bool("probe.unconfigured", false,
+		"Allow /probe to scrape targets that are not configured, sending them the password")
 	versionFlag = flag.Bool("version", false,
 		"Show gs1200-exporter version")
 	jsonLogging = flag.Bool("json", false,
@@ -28,6 +51,17 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "capture":
+			capture(os.Args[2:])
+			return
+		case "simulate":
+			simulate(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Parse()
 
 	if *jsonLogging {
@@ -50,16 +84,119 @@ func main() {
 		log.Info("gs1200-exporter ", Version)
 		os.Exit(0)
 	}
-	collector, err := gs1200.GS1200Collector(
-		getEnv("GS1200_ADDRESS", *gs1200Address),
-		getEnv("GS1200_PASSWORD", *gs1200Password),
-	)
+
+	if !gs1200.ValidLegacy(*metricsLegacy) {
+		log.Error("Unknown legacy metrics mode: ", *metricsLegacy)
+		os.Exit(1)
+	}
+
+	if !gs1200lib.ValidEngine(*parserEngine) {
+		log.Error("Unknown parser engine: ", *parserEngine)
+		os.Exit(1)
+	}
+
+	if err := gs1200.CheckSource(*source); err != nil {
+		log.Error("Invalid source: ", err)
+		os.Exit(1)
+	}
+
+	password := getEnv("GS1200_PASSWORD", *gs1200Password)
+	var config *gs1200.Config
+	var err error
+	if *configFile != "" {
+		config, err = gs1200.LoadConfig(*configFile)
+	} else {
+		config, err = gs1200.DefaultConfig(gs1200.SwitchConfig{
+			Address:         getEnv("GS1200_ADDRESS", *gs1200Address),
+			Password:        password,
+			KeepSession:     *keepSession,
+			OnConflict:      *onConflict,
+			ConflictTimeout: *conflictTimeout,
+			PollInterval:    *pollInterval,
+		})
+	}
 	if err != nil {
-		log.Error("Cannot start collector: ", err)
-		return
+		log.Error("Cannot load configuration: ", err)
+		os.Exit(1)
+	}
+	server := gs1200.GS1200Server(config, password, *listenPort)
+	server.Legacy = *metricsLegacy
+	server.Engine = *parserEngine
+	server.Source = *source
+	server.ProbeUnconfigured = *probeUnconfigured
+	server.Run()
+}
+
+// capture saves the files of a switch to a redacted bundle for a bug report.
+func capture(args []string) {
+	flags := flag.NewFlagSet("capture", flag.ExitOnError)
+	address := flags.String("address", "192.168.1.3",
+		"IP address or hostname of the GS1200")
+	password := flags.String("password", "********",
+		"Password to log on to the GS1200")
+	out := flags.String("out", "bundle.tar.gz",
+		"File to write the bundle to")
+	timeout := flags.Duration("timeout", time.Minute,
+		"How long to try capturing")
+	_ = flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	manifest, err := gs1200.CaptureBundle(ctx, getEnv("GS1200_ADDRESS", *address),
+		getEnv("GS1200_PASSWORD", *password), *out, Version)
+	if err != nil {
+		log.Error("Cannot capture: ", err)
+		os.Exit(1)
+	}
+	log.Info("Captured ", manifest.Model, " firmware ", manifest.Firmware, " to ", *out)
+}
+
+// simulate serves a fake switch.
+func simulate(args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	port := flags.String("port", "8080",
+		"Port on which to serve the simulated GS1200")
+	password := flags.String("password", "1234",
+		"Password to log on to the simulated GS1200")
+	ports := flags.Int("ports", 8,
+		"Number of ports")
+	poePorts := flags.Int("poe.ports", 4,
+		"Number of ports with PoE, 0 for none")
+	delay := flags.Duration("fault.delay", 0,
+		"Delay every response")
+	errorRate := flags.Float64("fault.errors", 0,
+		"Fraction of requests to answer with 500 Internal Server Error")
+	truncateRate := flags.Float64("fault.truncate", 0,
+		"Fraction of javascript files to cut off halfway")
+	conflictRate := flags.Float64("fault.conflict", 0,
+		"Fraction of logins to refuse as if somebody else is logged in")
+	debug := flags.Bool("debug", false,
+		"Enable debug logging")
+	_ = flags.Parse(args)
+
+	if *debug {
+		log.SetLevel(log.DebugLevel)
+	}
+	if *ports < 1 || *ports > 32 || *poePorts < 0 || *poePorts > *ports {
+		log.Error("Invalid number of ports: ", *ports, " with ", *poePorts, " PoE ports")
+		os.Exit(1)
+	}
+	sim := simulator.New(simulator.Config{
+		Password: *password,
+		Ports:    *ports,
+		PoEPorts: *poePorts,
+		Faults: simulator.Faults{
+			Delay:        *delay,
+			ErrorRate:    *errorRate,
+			TruncateRate: *truncateRate,
+			ConflictRate: *conflictRate,
+		},
+	})
+	log.Info("Simulating a ", sim.Model(), " on port ", *port)
+	if err := http.ListenAndServe(":"+*port, sim); err != nil {
+		log.Error(err)
+		os.Exit(1)
 	}
-	exporter := gs1200.GS1200Exporter(*collector, *listenPort)
-	exporter.Run()
 }
 
 func getEnv(key, fallback string) string {
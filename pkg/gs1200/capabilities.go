@@ -0,0 +1,52 @@
+package gs1200
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Capabilities describe which data a switch serves. They are discovered on
+// the first scrape, by probing the javascript files of all pages.
+type Capabilities struct {
+	// The pages served by the switch, next to the system page.
+	Pages []string
+	// Number of ports with PoE, 0 if the switch has no PoE.
+	PoEPorts int
+}
+
+// Serves reports whether the switch serves page.
+func (c *Capabilities) Serves(page string) bool {
+	return hasPage(c.Pages, page)
+}
+
+// discover probes which pages the switch serves. A page is missing when its
+// file is not found; any other error fails the discovery, which is then tried
+// again on the next scrape. Like fetch, it logs in again once if a kept
+// session expired.
+func (c *Client) discover(ctx context.Context, trace *Trace) (*Capabilities, error) {
+	capabilities := &Capabilities{}
+	for _, page := range AllPages {
+		file := pageFiles[page]
+		start := time.Now()
+		js, err := c.retry(ctx, trace, file, c.get)
+		trace.observe(PhaseDiscover, file, start)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			c.Logout(ctx)
+			return nil, err
+		}
+		capabilities.Pages = append(capabilities.Pages, page)
+		if page == PagePoE {
+			if err := c.ParseJS(ctx, js); err != nil {
+				return nil, &ParseError{File: file, Err: err}
+			}
+			capabilities.PoEPorts = len(c.GetArrayOfFloat("port_power"))
+		}
+	}
+	return capabilities, nil
+}
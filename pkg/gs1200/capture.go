@@ -0,0 +1,46 @@
+package gs1200
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// LoginFile is the name under which Capture saves the response to logging in.
+const LoginFile = "login.html"
+
+// Capture logs in and fetches every javascript file the switch may serve,
+// without parsing them, so the data of a switch that cannot be read can be
+// reported. The files are returned by name, next to the response to logging
+// in as LoginFile. Files the switch does not serve are left out.
+func (c *Client) Capture(ctx context.Context) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files := map[string]string{}
+	c.recorded = files
+	defer func() {
+		c.recorded = nil
+	}()
+	if err := c.Login(ctx); err != nil {
+		return nil, err
+	}
+	defer c.Logout(ctx)
+
+	names := []string{"system_data.js"}
+	for _, page := range AllPages {
+		names = append(names, pageFiles[page])
+	}
+	for _, name := range names {
+		js, err := c.get(ctx, name)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files[name] = js
+	}
+	return files, nil
+}
@@ -0,0 +1,546 @@
+// Package gs1200 is a client for the web interface of Zyxel GS1200 series
+// switches, which publish their data in a number of javascript files.
+package gs1200
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Client talks to a single switch. Its exported fields must be set before the
+// first call of Collect. Calls of Collect are serialized, as the switch allows
+// only one session at a time.
+type Client struct {
+	// Pages to fetch next to the system page, AllPages if nil.
+	Pages []string
+	// KeepSession keeps the login session between calls of Collect, instead
+	// of logging in and out every time.
+	KeepSession bool
+	// ConflictRetry is how long to retry logging in when somebody else is
+	// logged in. Zero fails right away.
+	ConflictRetry time.Duration
+	// Capabilities of the switch, discovered by the first call of Collect if
+	// nil. Setting them skips the discovery.
+	Capabilities *Capabilities
+	// Engine reading the javascript files, EngineLiteral if empty.
+	Engine string
+
+	address  string
+	password string
+	client   *http.Client
+
+	// The mutex serializes scrapes, which share the login session and the
+	// variables read.
+	mu       sync.Mutex
+	vars     engine
+	loggedIn bool
+	lastUsed time.Time
+	timeout  time.Duration
+	// The response to logging in, while capturing.
+	recorded map[string]string
+}
+
+const (
+	// The switch's idle timeout, until system_data.js tells otherwise.
+	defaultSessionTimeout = 5 * time.Minute
+	// Log in again a bit before the switch would expire the session.
+	sessionMargin = 15 * time.Second
+
+	initialBackoff = 250 * time.Millisecond
+	maxBackoff     = 2 * time.Second
+
+	// Time allowed for a single request, in case the caller's context has
+	// no deadline.
+	requestTimeout = 30 * time.Second
+	// Time allowed for logging out, even when the caller's context is done.
+	logoutTimeout = 2 * time.Second
+)
+
+// MaxResponseSize is the largest file read from the switch. Its files are a
+// few kilobytes at most.
+const MaxResponseSize = 1 << 20
+
+// readBody reads a response of at most MaxResponseSize bytes.
+func readBody(body io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, MaxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxResponseSize {
+		return nil, ErrResponseTooLarge
+	}
+	return data, nil
+}
+
+// NewClient returns a client for the switch at address. Every client gets its
+// own cookie jar, so sessions with different switches never get mixed up.
+func NewClient(address string, password string) (*Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &Client{
+		address:  address,
+		password: password,
+		client: &http.Client{
+			Jar:     jar,
+			Timeout: requestTimeout,
+			Transport: &http.Transport{
+				DisableKeepAlives: true,
+				MaxIdleConns:      5,
+			},
+		},
+		timeout: defaultSessionTimeout,
+	}
+	return client, nil
+}
+
+// Address returns the address of the switch.
+func (c *Client) Address() string {
+	return c.address
+}
+
+// hasPage reports whether page is in wanted, or wanted is nil, and served by
+// the switch.
+func (c *Client) hasPage(wanted []string, page string) bool {
+	if c.Capabilities != nil && !c.Capabilities.Serves(page) {
+		return false
+	}
+	return wanted == nil || hasPage(wanted, page)
+}
+
+func (c *Client) alive() bool {
+	return c.loggedIn && time.Since(c.lastUsed) < c.timeout-sessionMargin
+}
+
+// GetValue returns a variable of the javascript files read by the last call
+// of Collect: a string, int64, float64, bool, []interface{} or nil if it is
+// not defined.
+func (c *Client) GetValue(name string) interface{} {
+	if c.vars == nil {
+		return nil
+	}
+	return c.vars.get(name)
+}
+
+// The scalar accessors convert the variable like javascript would, and return
+// the zero value if it is not defined.
+
+func (c *Client) GetFloat(name string) float64 {
+	return toFloat(c.GetValue(name))
+}
+
+func (c *Client) GetString(name string) string {
+	return toString(c.GetValue(name))
+}
+
+func (c *Client) GetInt(name string) int {
+	return toInt(c.GetValue(name))
+}
+
+// The array accessors return nil if the variable is not an array of the
+// expected type.
+
+func (c *Client) GetArrayOfString(name string) []string {
+	return stringValues(c.GetValue(name))
+}
+
+func (c *Client) GetArrayOfArrayOfString(name string) [][]string {
+	array, ok := elements(c.GetValue(name))
+	if !ok {
+		return nil
+	}
+	result := [][]string{}
+	for _, value := range array {
+		row := stringValues(value)
+		if row == nil {
+			return nil
+		}
+		result = append(result, row)
+	}
+	return result
+}
+
+// GetArrayOfArrayOfInterface returns a nil element for every element that is
+// not an array itself.
+func (c *Client) GetArrayOfArrayOfInterface(name string) [][]interface{} {
+	array, ok := elements(c.GetValue(name))
+	if !ok {
+		return nil
+	}
+	result := [][]interface{}{}
+	for _, value := range array {
+		row, _ := elements(value)
+		result = append(result, row)
+	}
+	return result
+}
+
+func (c *Client) GetArrayOfInt(name string) []int {
+	array, ok := elements(c.GetValue(name))
+	if !ok {
+		return nil
+	}
+	result := []int{}
+	for _, value := range array {
+		f, ok := numberValue(value)
+		if !ok {
+			return nil
+		}
+		result = append(result, int(f))
+	}
+	return result
+}
+
+func (c *Client) GetArrayOfFloat(name string) []float64 {
+	array, ok := elements(c.GetValue(name))
+	if !ok {
+		return nil
+	}
+	result := []float64{}
+	for _, value := range array {
+		f, ok := numberValue(value)
+		if !ok {
+			return nil
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+// Collect scrapes the switch. The phases of the scrape are recorded in trace,
+// which may be nil. When ctx is done before the scrape is, the client still
+// tries to log out.
+func (c *Client) Collect(ctx context.Context, trace *Trace) (*SystemData, []PortData, error) {
+	return c.CollectPages(ctx, trace, c.Pages)
+}
+
+// CollectPages scrapes the switch like Collect, fetching the given pages
+// instead of the client's Pages. Nil fetches all pages.
+func (c *Client) CollectPages(ctx context.Context, trace *Trace, wanted []string) (*SystemData, []PortData, error) {
+	if trace == nil {
+		trace = &Trace{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	trace.begin()
+	defer trace.end()
+
+	c.vars = newEngine(c.Engine)
+
+	// Login, unless a kept session is still usable.
+	if !c.KeepSession || !c.alive() {
+		start := time.Now()
+		err := c.login(ctx, trace)
+		trace.observe(PhaseLogin, "", start)
+		if err != nil {
+			return nil, nil, trace.fail(PhaseLogin, err)
+		}
+	}
+
+	// Find out what the switch serves, once.
+	if c.Capabilities == nil {
+		capabilities, err := c.discover(ctx, trace)
+		if err != nil {
+			return nil, nil, trace.fail(PhaseDiscover, err)
+		}
+		c.Capabilities = capabilities
+	}
+
+	// Fetch and parse the javascript files containing all the data. The
+	// system page is always needed, the rest is optional.
+	files := []string{"system_data.js"}
+	pages := []string{}
+	for _, page := range AllPages {
+		if c.hasPage(wanted, page) {
+			files = append(files, pageFiles[page])
+			pages = append(pages, page)
+		}
+	}
+	for _, file := range files {
+		if err := c.load(ctx, trace, file); err != nil {
+			return nil, nil, err
+		}
+	}
+	if timeout := c.GetInt("http_timeout_time"); timeout > 0 {
+		c.timeout = time.Duration(timeout) * time.Minute
+	}
+
+	// Clear the session, unless it is kept for the next scrape.
+	if !c.KeepSession {
+		start := time.Now()
+		c.Logout(ctx)
+		trace.observe(PhaseLogout, "", start)
+	}
+
+	// Read the data the way the switch's model and firmware lay it out.
+	model, firmware := c.GetString("model_name"), c.GetString("sys_fmw_ver")
+	parser, ok := ParserFor(model, firmware)
+	if !ok {
+		log.Debug("No parser for ", model, " firmware ", firmware, ", using the fallback")
+	}
+	systemData, portData, err := parse(parser, c, pages, c.Capabilities)
+	if err != nil {
+		return nil, nil, trace.fail(PhaseParse, &ParseError{Err: err})
+	}
+	if len(systemData.ParseErrors) > 0 {
+		log.Warn("Cannot parse ", strings.Join(systemData.ParseErrors, ", "), " of ", c.address)
+	}
+	return systemData, portData, nil
+}
+
+// parse runs a parser, turning a panic into an error so odd data from a switch
+// fails only the scrape.
+func parse(parser Parser, vars Variables, pages []string, capabilities *Capabilities) (systemData *SystemData, portData []PortData, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			systemData, portData, err = nil, nil, fmt.Errorf("parser panicked: %v", r)
+		}
+	}()
+	return parser.Parse(vars, pages, capabilities)
+}
+
+// load fetches and parses a javascript file.
+func (c *Client) load(ctx context.Context, trace *Trace, file string) error {
+	start := time.Now()
+	js, err := c.fetch(ctx, trace, file)
+	trace.observe(PhaseFetch, file, start)
+	if err != nil {
+		return trace.fail(PhaseFetch, err)
+	}
+	start = time.Now()
+	err = c.ParseJS(ctx, js)
+	trace.observe(PhaseParse, file, start)
+	if err != nil {
+		return trace.fail(PhaseParse, &ParseError{File: file, Err: err})
+	}
+	return nil
+}
+
+// FetchJS fetches a javascript file, logging out when that fails.
+func (c *Client) FetchJS(ctx context.Context, filename string) (string, error) {
+	js, err := c.get(ctx, filename)
+	if err != nil && !errors.Is(err, ErrSessionExpired) {
+		c.Logout(ctx)
+	}
+	return js, err
+}
+
+// get fetches a javascript file.
+func (c *Client) get(ctx context.Context, filename string) (string, error) {
+	fileUrl := "http://" + c.address + "/" + filename
+	log.Debug("Fetch " + fileUrl)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		log.Debug("... fetch error: ", err)
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		err := &StatusError{URL: fileUrl, StatusCode: resp.StatusCode, Status: resp.Status}
+		log.Debug("... fetch error: ", err)
+		return "", err
+	}
+	body, err := readBody(resp.Body)
+	if err != nil {
+		log.Debug("... fetch error: ", err)
+		return "", err
+	}
+
+	// Without a valid session the switch serves the login page instead.
+	if strings.Contains(strings.ToLower(string(body)), "<html") {
+		log.Debug("... fetch error: ", ErrSessionExpired)
+		c.loggedIn = false
+		return "", ErrSessionExpired
+	}
+	c.lastUsed = time.Now()
+
+	return string(body), nil
+}
+
+// fetch fetches a javascript file, logging in again once if a kept session
+// turns out to have expired.
+func (c *Client) fetch(ctx context.Context, trace *Trace, filename string) (string, error) {
+	return c.retry(ctx, trace, filename, c.FetchJS)
+}
+
+// retry fetches a javascript file with get, logging in again once if a kept
+// session expired.
+func (c *Client) retry(ctx context.Context, trace *Trace, filename string, get func(context.Context, string) (string, error)) (string, error) {
+	js, err := get(ctx, filename)
+	if c.KeepSession && errors.Is(err, ErrSessionExpired) {
+		log.Debug("Session expired, logging in again")
+		if err = c.login(ctx, trace); err != nil {
+			return "", err
+		}
+		js, err = get(ctx, filename)
+	}
+	return js, err
+}
+
+// ParseJS reads the variables of a javascript file with the client's engine.
+// They can then be read with the Get methods.
+func (c *Client) ParseJS(ctx context.Context, js string) error {
+	log.Debug("Parse JavaScript\n" + js)
+	if c.vars == nil {
+		c.vars = newEngine(c.Engine)
+	}
+	err := c.vars.run(ctx, js)
+	if err != nil {
+		log.Debug("... parse error: ", err)
+		c.Logout(ctx)
+		return err
+	}
+	return nil
+}
+
+// EncryptPassword obfuscates the password like the switch's login page does.
+func (c *Client) EncryptPassword(password string) string {
+	const letters = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	result := ""
+	for i := 0; i <= len(password); i++ {
+		result = result + string(letters[rand.Intn(len(letters))])
+		if i < len(password) {
+			result = result + string(rune(int(password[i])-len(password)))
+		}
+	}
+	return result
+}
+
+func (c *Client) Login(ctx context.Context) error {
+	// Log in on the GS1200.
+
+	loginUrl := "http://" + c.address + "/login.cgi"
+	log.Debug("Logging in at " + loginUrl)
+	form := url.Values{"password": {c.EncryptPassword(c.password)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, loginUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		log.Debug("... login error: ", err)
+		// Even though logging in failed, try to log out, clearing the
+		// session.
+		c.Logout(ctx)
+		return err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		log.Debug("... login error: ", resp.Status)
+		return &StatusError{URL: loginUrl, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	body, err := readBody(resp.Body)
+	if err != nil {
+		log.Debug("... login read error: ", err)
+		c.Logout(ctx)
+		return err
+	}
+
+	if c.recorded != nil {
+		c.recorded[LoginFile] = string(body)
+	}
+
+	// Somebody else is logged in.
+	if strings.Contains(string(body), "If a user is logged in already") {
+		log.Debug("... login failed, already logged in")
+		return ErrLoggedInElsewhere
+	}
+
+	// Curiously, a failed login wil happily return 200.
+	if strings.Contains(string(body), "<title>Message</title>") &&
+		strings.Contains(string(body), "alert(\"Incorrect password, please try again.\");") {
+		log.Debug("... incorrect password")
+		c.Logout(ctx)
+		return ErrIncorrectPassword
+	}
+
+	c.loggedIn = true
+	c.lastUsed = time.Now()
+	return nil
+}
+
+// login logs in, retrying with backoff for up to ConflictRetry while somebody
+// else is logged in, but not beyond the deadline of ctx.
+func (c *Client) login(ctx context.Context, trace *Trace) error {
+	deadline := time.Now().Add(c.ConflictRetry)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	backoff := initialBackoff
+	for {
+		err := c.Login(ctx)
+		if !errors.Is(err, ErrLoggedInElsewhere) {
+			return err
+		}
+		trace.Conflicts++
+		if time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+		log.Debug("... retrying login in ", backoff)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// Logout ends the session. It is attempted even when ctx is done, so an
+// aborted scrape does not lock others out of the switch.
+func (c *Client) Logout(ctx context.Context) {
+	c.loggedIn = false
+	logoutUrl := "http://" + c.address + "/logout.html"
+	log.Debug("Logging out at " + logoutUrl)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), logoutTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, logoutUrl, nil)
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	_, err = io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		log.Warn(err)
+	}
+}
+
+// Close ends a kept session, if any.
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loggedIn {
+		c.Logout(context.Background())
+	}
+}
@@ -0,0 +1,708 @@
+package gs1200
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/robinelfrink/gs1200-exporter/internal/samples"
+)
+
+func TestClient_Login(t *testing.T) {
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{
+			name:     "correct password",
+			password: "OFcVQl1shaUM",
+			wantErr:  false,
+		},
+		{
+			name:     "wrong password",
+			password: "Niovei4uR2ao",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), tt.password)
+			if err := c.Login(t.Context()); (err != nil) != tt.wantErr {
+				t.Errorf("Client.Login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_Logout(t *testing.T) {
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+
+	t.Run("logout", func(t *testing.T) {
+		c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "unused")
+		c.Logout(t.Context())
+	})
+}
+
+func TestClient_EncryptPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		match    string
+	}{
+		{
+			name:     "8 characters",
+			password: "xue2That",
+			match:    "^.p.m.].*.L.`.Y.l.$",
+		},
+		{
+			name:     "12 characters",
+			password: "Gae9ahVahzah",
+			match:    "^.;.U.Y.-.U.\\\\.J.U.\\\\.n.U.\\\\.$",
+		},
+		{
+			name:     "15 characters",
+			password: "muthuj0Eicha3ah",
+			match:    "^.\\^.f.e.Y.f.\\[.!.6.Z.T.Y.R.\\$.R.Y.$",
+		},
+	}
+	c, _ := NewClient("127.0.0.1", "secret")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.EncryptPassword(tt.password)
+			match, err := regexp.MatchString(tt.match, got)
+			if err != nil {
+				t.Errorf("Client.EncryptPassword() failed: %v", err)
+			} else if !match {
+				t.Errorf("Client.EncryptPassword() = %v, should match %v", got, tt.match)
+			}
+		})
+	}
+}
+
+func TestClient_FetchJS(t *testing.T) {
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+
+	tests := []struct {
+		filename string
+		size     int
+		wantErr  bool
+	}{
+		{
+			filename: "link_data.js",
+			size:     569,
+			wantErr:  false,
+		},
+		{
+			filename: "system_data.js",
+			size:     644,
+			wantErr:  false,
+		},
+		{
+			filename: "VLAN_1Q_List_data.js",
+			size:     166,
+			wantErr:  false,
+		},
+		{
+			filename: "world_peace.js",
+			size:     0,
+			wantErr:  true,
+		},
+	}
+	c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+	if err := c.Login(t.Context()); err != nil {
+		t.Fatalf("Client.Login() error = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got, err := c.FetchJS(t.Context(), tt.filename)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.FetchJS(%v) error = %v, wantErr %v", tt.filename, err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && len(got) != tt.size {
+				t.Errorf("Client.FetchJS(%v) = %v bytes, want %v bytes", tt.filename, len(got), tt.size)
+			}
+		})
+	}
+}
+
+func TestClient_ParseJS(t *testing.T) {
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+
+	tests := []struct {
+		filename string
+		key      string
+		want     string
+	}{
+		{
+			filename: "system_data.js",
+			key:      "model_name",
+			want:     "GS1200-8HP v2",
+		},
+		{
+			filename: "link_data.js",
+			key:      "portstatus",
+			want:     "Up,Down,Down,Down,Up,Down,Down,Up",
+		},
+		{
+			filename: "VLAN_1Q_List_data.js",
+			key:      "port_nums",
+			want:     "8",
+		},
+	}
+	for _, engine := range []string{EngineLiteral, EngineOtto} {
+		for _, tt := range tests {
+			t.Run(engine+"/"+tt.filename, func(t *testing.T) {
+				c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+				c.Engine = engine
+				if err := c.Login(t.Context()); err != nil {
+					t.Fatalf("Client.Login() error = %v", err)
+				}
+				defer c.Logout(t.Context())
+				js, err := c.FetchJS(t.Context(), tt.filename)
+				if err != nil {
+					t.Errorf("Client.ParseJS(%v) error = %v", tt.filename, err)
+					return
+				}
+				if err = c.ParseJS(t.Context(), js); err != nil {
+					t.Errorf("Client.ParseJS(%v) error = %v", tt.filename, err)
+					return
+				}
+				if got := c.GetString(tt.key); got != tt.want {
+					t.Errorf("Client.ParseJS() error = failed key %v: %v, want %v", tt.key, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestClient_Collect(t *testing.T) {
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		ok   func(SystemData, []PortData) error
+	}{
+		{
+			name: "model name",
+			ok: func(s SystemData, p []PortData) error {
+				if s.Model == "GS1200-8HP v2" {
+					return nil
+				}
+				return errors.New(s.Model)
+			},
+		},
+		{
+			name: "port 5 speed",
+			ok: func(s SystemData, p []PortData) error {
+				if p[4].Speed == 1000 {
+					return nil
+				}
+				return fmt.Errorf("%d", p[4].Speed)
+			},
+		},
+		{
+			name: "port 3 primary vlan",
+			ok: func(s SystemData, p []PortData) error {
+				if p[2].PVLAN == "1" {
+					return nil
+				}
+				return errors.New(p[2].PVLAN)
+			},
+		},
+		{
+			name: "build date",
+			ok: func(s SystemData, p []PortData) error {
+				if s.BuildDate.Equal(time.Date(2021, 12, 17, 0, 0, 0, 0, time.UTC)) && s.Uptime == 238*time.Second {
+					return nil
+				}
+				return fmt.Errorf("%v %v", s.BuildDate, s.Uptime)
+			},
+		},
+		{
+			name: "port speed",
+			ok: func(s SystemData, p []PortData) error {
+				if p[7].BitsPerSecond() == 100e6 && p[1].BitsPerSecond() == 0 {
+					return nil
+				}
+				return fmt.Errorf("%v %v", p[7].BitsPerSecond(), p[1].BitsPerSecond())
+			},
+		},
+		{
+			name: "port counters",
+			ok: func(s SystemData, p []PortData) error {
+				rx := p[0].Stats.RXCounters
+				columns := p[0].Stats.Columns
+				if rx.Unicast == 3337 && rx.Multicast == 0 && p[0].Stats.RX == 3337 &&
+					len(columns) == 5 && columns[0] == 65432 && columns[9] == 256 {
+					return nil
+				}
+				return fmt.Errorf("%+v %v", rx, columns)
+			},
+		},
+		{
+			name: "pvid",
+			ok: func(s SystemData, p []PortData) error {
+				if p[2].PVID == 1 && len(p[2].UntaggedVLANs) == 1 && p[2].UntaggedVLANs[0] == "1" {
+					return nil
+				}
+				return fmt.Errorf("%d %v", p[2].PVID, p[2].UntaggedVLANs)
+			},
+		},
+		{
+			name: "max led power",
+			ok: func(s SystemData, p []PortData) error {
+				if s.MaxLEDPower != nil && *s.MaxLEDPower == 50 {
+					return nil
+				}
+				return fmt.Errorf("%v", s.MaxLEDPower)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+			s, p, err := c.Collect(t.Context(), nil)
+			if err != nil {
+				t.Errorf("Client.Collect() error = %v", err)
+				return
+			}
+			if err := tt.ok(*s, p); err != nil {
+				t.Errorf("Client.Collect() error = wrong value %v", err)
+				return
+			}
+		})
+	}
+}
+
+func TestClient_KeepSession(t *testing.T) {
+	var mu sync.Mutex
+	logins, logouts, expire := 0, 0, false
+	fake := samples.TestingHandler(samples.Default)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case req.URL.String() == "/login.cgi":
+			logins++
+			expire = false
+		case req.URL.String() == "/logout.html":
+			logouts++
+		case expire:
+			_, _ = rw.Write([]byte("<html><head><title>Login</title></head></html>"))
+			return
+		}
+		fake.ServeHTTP(rw, req)
+	}))
+	// Close the server when test finishes
+	defer server.Close()
+
+	c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+	c.KeepSession = true
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := c.Collect(t.Context(), nil); err != nil {
+			t.Fatalf("Client.Collect() error = %v", err)
+		}
+	}
+	if logins != 1 || logouts != 0 {
+		t.Errorf("Client.Collect() logins = %d, logouts = %d, want 1 and 0", logins, logouts)
+	}
+	if c.timeout != 5*time.Minute {
+		t.Errorf("Client.Collect() session timeout = %v, want 5m", c.timeout)
+	}
+
+	// The switch expired the session, and serves the login page instead.
+	mu.Lock()
+	expire = true
+	mu.Unlock()
+	if _, _, err := c.Collect(t.Context(), nil); err != nil {
+		t.Fatalf("Client.Collect() error = %v", err)
+	}
+	if logins != 2 || logouts != 0 {
+		t.Errorf("Client.Collect() logins = %d, logouts = %d, want 2 and 0", logins, logouts)
+	}
+
+	// Discovery, when it is tried again, logs in again too.
+	mu.Lock()
+	expire = true
+	mu.Unlock()
+	c.Capabilities = nil
+	if _, _, err := c.Collect(t.Context(), nil); err != nil {
+		t.Fatalf("Client.Collect() error = %v", err)
+	}
+	if logins != 3 || logouts != 0 {
+		t.Errorf("Client.Collect() logins = %d, logouts = %d, want 3 and 0", logins, logouts)
+	}
+
+	c.Close()
+	c.Close()
+	if logouts != 1 {
+		t.Errorf("Client.Close() logouts = %d, want 1", logouts)
+	}
+}
+
+func TestClient_Timeout(t *testing.T) {
+	var mu sync.Mutex
+	logouts := 0
+	hang := make(chan struct{})
+	fake := samples.TestingHandler(samples.Default)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.String() {
+		case "/link_data.js":
+			// The switch hangs mid-response.
+			<-hang
+			return
+		case "/logout.html":
+			mu.Lock()
+			logouts++
+			mu.Unlock()
+		}
+		fake.ServeHTTP(rw, req)
+	}))
+	// Close the server when test finishes
+	defer server.Close()
+	defer close(hang)
+
+	c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+	c.Capabilities = &Capabilities{Pages: AllPages, PoEPorts: 4}
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	trace := &Trace{}
+	_, _, err := c.Collect(ctx, trace)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Client.Collect() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if trace.FailedPhase != PhaseFetch {
+		t.Errorf("Client.Collect() failed phase = %v, want %v", trace.FailedPhase, PhaseFetch)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Client.Collect() took %v, want about 200ms", elapsed)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if logouts != 1 {
+		t.Errorf("Client.Collect() logouts = %d, want 1", logouts)
+	}
+}
+
+func TestClient_Sandbox(t *testing.T) {
+	tests := []struct {
+		name  string
+		js    string
+		err   error
+		phase string
+	}{
+		{
+			name:  "infinite loop",
+			js:    "while (true) {}",
+			err:   ErrScriptTimeout,
+			phase: PhaseParse,
+		},
+		{
+			name:  "builtins",
+			js:    "var portstatus = Array('Up');",
+			phase: PhaseParse,
+		},
+		{
+			name:  "too large",
+			js:    "var portstatus = ['" + strings.Repeat("Up", MaxResponseSize) + "'];",
+			err:   ErrResponseTooLarge,
+			phase: PhaseFetch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(samples.Rewrite(samples.Default, "link_data.js", "", tt.js))
+			// Close the server when test finishes
+			defer server.Close()
+
+			c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+			c.Engine = EngineOtto
+			c.Capabilities = &Capabilities{Pages: AllPages, PoEPorts: 4}
+			ctx, cancel := context.WithTimeout(t.Context(), 500*time.Millisecond)
+			defer cancel()
+			trace := &Trace{}
+			_, _, err := c.Collect(ctx, trace)
+			if err == nil || tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Client.Collect() error = %v, want %v", err, tt.err)
+			}
+			if trace.FailedPhase != tt.phase {
+				t.Errorf("Client.Collect() failed phase = %v, want %v", trace.FailedPhase, tt.phase)
+			}
+		})
+	}
+}
+
+func TestClient_LoginTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte("<html>" + strings.Repeat(" ", MaxResponseSize) + "</html>"))
+	}))
+	// Close the server when test finishes
+	defer server.Close()
+
+	c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+	if err := c.Login(t.Context()); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("Client.Login() error = %v, want %v", err, ErrResponseTooLarge)
+	}
+}
+
+func TestClient_ConflictRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		retry     time.Duration
+		busy      int
+		wantErr   bool
+		conflicts int
+	}{
+		{
+			name:      "no retry",
+			retry:     0,
+			busy:      1,
+			wantErr:   true,
+			conflicts: 1,
+		},
+		{
+			name:      "retry",
+			retry:     time.Second,
+			busy:      2,
+			wantErr:   false,
+			conflicts: 2,
+		},
+		{
+			name:      "retry until timeout",
+			retry:     time.Second,
+			busy:      100,
+			wantErr:   true,
+			conflicts: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			busy := tt.busy
+			fake := samples.TestingHandler(samples.Default)
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				if req.URL.String() == "/login.cgi" && busy > 0 {
+					busy--
+					_, _ = rw.Write([]byte("If a user is logged in already, please try again later."))
+					return
+				}
+				fake.ServeHTTP(rw, req)
+			}))
+			// Close the server when test finishes
+			defer server.Close()
+
+			c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+			c.ConflictRetry = tt.retry
+			trace := &Trace{}
+			s, p, err := c.Collect(t.Context(), trace)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Collect() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && (!errors.Is(err, ErrLoggedInElsewhere) || trace.FailedPhase != PhaseLogin) {
+				t.Errorf("Client.Collect() error = %v in %v, want %v in %v", err, trace.FailedPhase, ErrLoggedInElsewhere, PhaseLogin)
+			}
+			if err == nil && (s.Model != "GS1200-8HP v2" || len(p) != 8) {
+				t.Errorf("Client.Collect() = %v, %v ports", s.Model, len(p))
+			}
+			if trace.Conflicts != tt.conflicts {
+				t.Errorf("Client.Collect() conflicts = %v, want %v", trace.Conflicts, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+
+	c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "Niovei4uR2ao")
+	trace := &Trace{}
+	_, _, err := c.Collect(t.Context(), trace)
+	if !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("Client.Collect() error = %v, want %v", err, ErrIncorrectPassword)
+	}
+	if trace.FailedPhase != PhaseLogin || trace.Err != err {
+		t.Errorf("Client.Collect() trace = %v %v, want %v", trace.FailedPhase, trace.Err, PhaseLogin)
+	}
+
+	c, _ = NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+	_, err = c.FetchJS(t.Context(), "world_peace.js")
+	var statusErr *StatusError
+	if !errors.Is(err, ErrUnexpectedStatus) || !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Client.FetchJS() error = %v, want %v", err, http.StatusNotFound)
+	}
+}
+
+func TestClient_ParallelCollect(t *testing.T) {
+	// Two clients of two switches, each scraped concurrently, like a pair of
+	// Prometheus servers would. Run with -race to detect shared state.
+	collectors := make([]*Client, 2)
+	for i := range collectors {
+		server := httptest.NewServer(samples.TestingHandler(samples.Default))
+		// Close the server when test finishes
+		defer server.Close()
+		collectors[i], _ = NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		c := collectors[i%len(collectors)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, p, err := c.Collect(t.Context(), nil)
+			if err != nil {
+				t.Errorf("Client.Collect() error = %v", err)
+				return
+			}
+			if s.Model != "GS1200-8HP v2" || len(p) != 8 || p[4].Speed != 1000 {
+				t.Errorf("Client.Collect() = %v, %v ports", s.Model, len(p))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestClient_Discover(t *testing.T) {
+	tests := []struct {
+		name     string
+		missing  string
+		pages    []string
+		poePorts int
+	}{
+		{
+			name:     "poe",
+			missing:  "",
+			pages:    AllPages,
+			poePorts: 4,
+		},
+		{
+			name:     "no poe",
+			missing:  "/poe_data.js",
+			pages:    []string{PageLink, PageVLAN},
+			poePorts: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			requests := map[string]int{}
+			fake := samples.TestingHandler(samples.Default)
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				requests[req.URL.String()]++
+				mu.Unlock()
+				if req.URL.String() == tt.missing {
+					http.NotFound(rw, req)
+					return
+				}
+				fake.ServeHTTP(rw, req)
+			}))
+			// Close the server when test finishes
+			defer server.Close()
+
+			c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+			for i := 0; i < 2; i++ {
+				s, p, err := c.Collect(t.Context(), nil)
+				if err != nil {
+					t.Fatalf("Client.Collect() error = %v", err)
+				}
+				if s.PoE != (tt.poePorts > 0) || s.PoEPorts != tt.poePorts {
+					t.Errorf("Client.Collect() PoE = %v with %d ports, want %d ports", s.PoE, s.PoEPorts, tt.poePorts)
+				}
+				if got := p[0].Stats.Power > 0; got != (tt.poePorts > 0) {
+					t.Errorf("Client.Collect() port 1 power = %v", p[0].Stats.Power)
+				}
+			}
+			if got := fmt.Sprint(c.Capabilities.Pages); got != fmt.Sprint(tt.pages) {
+				t.Errorf("Client.Capabilities.Pages = %v, want %v", got, tt.pages)
+			}
+			// The first scrape discovers, the second one only fetches what
+			// is served.
+			mu.Lock()
+			defer mu.Unlock()
+			poe := 1
+			if tt.poePorts > 0 {
+				poe = 3
+			}
+			if requests["/link_data.js"] != 3 || requests["/poe_data.js"] != poe {
+				t.Errorf("Client.Collect() requests = %v", requests)
+			}
+		})
+	}
+}
+
+func TestClient_Replay(t *testing.T) {
+	tests := []struct {
+		name  string
+		skip  string
+		model string
+		ports int
+		pages []string
+	}{
+		{
+			name:  "all files",
+			model: "GS1200-8HP v2",
+			ports: 8,
+			pages: AllPages,
+		},
+		{
+			name:  "no poe",
+			skip:  "poe_data.js",
+			model: "GS1200-8HP v2",
+			ports: 8,
+			pages: []string{PageLink, PageVLAN},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := fstest.MapFS{}
+			entries, _ := fs.ReadDir(samples.FS, samples.Default)
+			for _, entry := range entries {
+				if entry.Name() != tt.skip {
+					data, _ := samples.FS.ReadFile(samples.Default + "/" + entry.Name())
+					files[entry.Name()] = &fstest.MapFile{Data: data}
+				}
+			}
+			c, _ := NewReplayClient("replay", files)
+			s, p, err := c.Collect(t.Context(), nil)
+			if err != nil {
+				t.Fatalf("Client.Collect() error = %v", err)
+			}
+			if s.Model != tt.model || len(p) != tt.ports {
+				t.Errorf("Client.Collect() = %v with %d ports, want %v with %d", s.Model, len(p), tt.model, tt.ports)
+			}
+			if got := fmt.Sprint(c.Capabilities.Pages); got != fmt.Sprint(tt.pages) {
+				t.Errorf("Client.Capabilities.Pages = %v, want %v", got, tt.pages)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package gs1200
+
+import "time"
+
+// SystemData describes the switch as a whole.
+type SystemData struct {
+	MaxPort  int
+	Model    string
+	Firmware string
+	IP       string
+	MAC      string
+	Loop     string
+	// Time since the switch booted, zero if unknown.
+	Uptime time.Duration
+	// When the firmware was built, zero if unknown.
+	BuildDate time.Time
+	VLANs     []string
+	// Whether PoE data was collected.
+	PoE bool
+	// Number of ports with PoE, counting from the first port.
+	PoEPorts int
+	// The PoE power budget in Watts, nil if unknown.
+	TotalPower *int
+	// The draw in Watts above which the PoE LED lights up, nil if unknown.
+	MaxLEDPower *int
+	// The actual PoE draw in Watts, nil if unknown.
+	RealPower *float64
+	Settings  Settings
+	// The configured trunk groups.
+	Trunks []Trunk
+	// The fields that could not be parsed, once for every time it failed.
+	// Their data is left out.
+	ParseErrors []string
+}
+
+// Settings are the switch's network and device settings. The flags are nil if
+// they could not be parsed.
+type Settings struct {
+	DeviceName string
+	SubnetMask string
+	Gateway    string
+	// Whether the switch gets its address by DHCP.
+	DHCP *bool
+	// Whether Energy Efficient Ethernet is enabled.
+	EEE *bool
+	// The LED setting, as the switch serves it.
+	LED *int
+	// Whether the switch still awaits its first login, which sets the
+	// password.
+	FirstLogin *bool
+}
+
+// Trunk is a group of ports aggregated into a single link.
+type Trunk struct {
+	Name string
+	// The names of the member ports.
+	Ports []string
+}
+
+type PortStats struct {
+	// Packets received and transmitted, as totalled by the web interface.
+	RX float64
+	TX float64
+	// The counters behind the totals.
+	RXCounters PortCounters
+	TXCounters PortCounters
+	// The columns of the Stats row whose meaning is not known, by index.
+	Columns map[int]float64
+	Power   float64
+}
+
+// PortCounters are the packet counters of a port in one direction, from the
+// Stats array in link_data.js. Each row has 11 columns; the web interface
+// totals columns 1-3 as transmitted and columns 6-8 and 10 as received
+// packets. Columns 1-3 and 6-8 hold unicast, multicast and broadcast packets.
+// The meaning of columns 0, 4, 5, 9 and 10 is not known, so they are kept
+// as they are in PortStats.Columns.
+type PortCounters struct {
+	Unicast   float64
+	Multicast float64
+	Broadcast float64
+}
+
+// PortData describes a single port.
+type PortData struct {
+	Name       string
+	LoopStatus string
+	Status     string
+	Speed      int
+	SpeedUnit  string
+	Duplex     string
+	Stats      PortStats
+	// The untagged VLAN, or "0". The last one if the port is an untagged
+	// member of several VLANs.
+	PVLAN string
+	// The tagged VLANs.
+	VLANs []string
+	// The VLANs the port is an untagged member of.
+	UntaggedVLANs []string
+	// The VLAN assigned to untagged incoming traffic, 0 if unknown.
+	PVID int
+}
+
+// The units of PortData.SpeedUnit.
+var speedUnits = map[string]float64{
+	"Kbps": 1e3,
+	"Mbps": 1e6,
+	"Gbps": 1e9,
+}
+
+// BitsPerSecond returns the speed of the port, or 0 if the unit is unknown.
+func (p PortData) BitsPerSecond() float64 {
+	return float64(p.Speed) * speedUnits[p.SpeedUnit]
+}
+
+// Pages of data, next to the always required system page.
+const (
+	PageLink = "link"
+	PageVLAN = "vlan"
+	PagePoE  = "poe"
+)
+
+// The javascript files backing each page.
+var pageFiles = map[string]string{
+	PageLink: "link_data.js",
+	PageVLAN: "VLAN_1Q_List_data.js",
+	PagePoE:  "poe_data.js",
+}
+
+// AllPages are fetched unless a client is told otherwise.
+var AllPages = []string{PageLink, PageVLAN, PagePoE}
+
+// ValidPage reports whether page is a known page.
+func ValidPage(page string) bool {
+	_, ok := pageFiles[page]
+	return ok
+}
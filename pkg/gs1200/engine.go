@@ -0,0 +1,223 @@
+package gs1200
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robertkrimen/otto"
+)
+
+// Engines reading the switch's javascript files.
+const (
+	// EngineLiteral parses the files as variables with literal values,
+	// without running them. It is the default.
+	EngineLiteral = "literal"
+	// EngineOtto runs the files in a javascript VM, for firmware whose files
+	// hold more than literals.
+	EngineOtto = "otto"
+)
+
+// ValidEngine reports whether engine is a known engine.
+func ValidEngine(engine string) bool {
+	return engine == EngineLiteral || engine == EngineOtto
+}
+
+// engine holds the variables of the javascript files read during a scrape.
+type engine interface {
+	run(ctx context.Context, js string) error
+	// get returns a variable as a string, int64, float64, bool, slice or
+	// nil if it is not defined.
+	get(name string) interface{}
+}
+
+func newEngine(name string) engine {
+	if name == EngineOtto {
+		return ottoEngine{}
+	}
+	return literalEngine{}
+}
+
+type literalEngine map[string]interface{}
+
+func (e literalEngine) run(ctx context.Context, js string) error {
+	vars, err := ParseLiterals(js)
+	if err != nil {
+		return err
+	}
+	for name, value := range vars {
+		e[name] = value
+	}
+	return nil
+}
+
+func (e literalEngine) get(name string) interface{} {
+	return e[name]
+}
+
+// Time the otto engine allows a file to run.
+const scriptTimeout = time.Second
+
+// ottoBuiltins are the globals of a VM. The switch's data needs none of them,
+// so they are removed before running a file.
+var ottoBuiltins = []string{
+	"Object", "Function", "Array", "String", "Boolean", "Number", "Math",
+	"Date", "RegExp", "Error", "EvalError", "TypeError", "RangeError",
+	"ReferenceError", "SyntaxError", "URIError", "JSON", "eval", "parseInt",
+	"parseFloat", "isNaN", "isFinite", "decodeURI", "decodeURIComponent",
+	"encodeURI", "encodeURIComponent", "escape", "unescape", "console",
+}
+
+// errInterrupted halts a VM.
+var errInterrupted = errors.New("interrupted")
+
+// ottoEngine runs every file in a VM of its own, and keeps the variables it
+// sets.
+type ottoEngine map[string]interface{}
+
+func (e ottoEngine) run(ctx context.Context, js string) (err error) {
+	vm := otto.New()
+	for _, name := range ottoBuiltins {
+		_ = vm.Set(name, otto.UndefinedValue())
+	}
+	global, err := vm.Object("this")
+	if err != nil {
+		return err
+	}
+	builtins := map[string]bool{}
+	for _, name := range global.Keys() {
+		builtins[name] = true
+	}
+
+	// Halt the VM when the file runs too long.
+	ctx, cancel := context.WithTimeout(ctx, scriptTimeout)
+	defer cancel()
+	vm.Interrupt = make(chan func(), 1)
+	stop := context.AfterFunc(ctx, func() {
+		vm.Interrupt <- func() {
+			panic(errInterrupted)
+		}
+	})
+	defer stop()
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errInterrupted {
+				panic(r)
+			}
+			err = ErrScriptTimeout
+		}
+	}()
+
+	if _, err := vm.Run(js); err != nil {
+		return err
+	}
+	for _, name := range global.Keys() {
+		if builtins[name] {
+			continue
+		}
+		value, _ := global.Get(name)
+		e[name], _ = value.Export()
+	}
+	return nil
+}
+
+func (e ottoEngine) get(name string) interface{} {
+	return e[name]
+}
+
+// The conversions below follow javascript's, so the engines read the same
+// values the switch's own pages do.
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	if array, ok := elements(value); ok {
+		values := make([]string, len(array))
+		for i, element := range array {
+			values[i] = toString(element)
+		}
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	}
+	if f, ok := numberValue(value); ok {
+		return f
+	}
+	s := strings.TrimSpace(toString(value))
+	if s == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+
+func toInt(value interface{}) int {
+	f := toFloat(value)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	return int(f)
+}
+
+// elements returns the elements of an array, which otto exports as a slice of
+// whatever type its elements share.
+func elements(value interface{}) ([]interface{}, bool) {
+	if array, ok := value.([]interface{}); ok {
+		return array, true
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		return nil, false
+	}
+	result := make([]interface{}, v.Len())
+	for i := range result {
+		result[i] = v.Index(i).Interface()
+	}
+	return result, true
+}
+
+// stringValues returns the elements of an array of strings, or nil.
+func stringValues(value interface{}) []string {
+	array, ok := elements(value)
+	if !ok {
+		return nil
+	}
+	result := []string{}
+	for _, element := range array {
+		s, ok := element.(string)
+		if !ok {
+			return nil
+		}
+		result = append(result, s)
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package gs1200
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrIncorrectPassword is returned when the switch rejects the password.
+	ErrIncorrectPassword = errors.New("incorrect password")
+	// ErrLoggedInElsewhere is returned when somebody else is logged in.
+	ErrLoggedInElsewhere = errors.New("logged in elsewhere")
+	// ErrUnexpectedStatus is matched by every StatusError.
+	ErrUnexpectedStatus = errors.New("unexpected status")
+	// ErrSessionExpired is returned when the switch serves its login page
+	// instead of the requested file.
+	ErrSessionExpired = errors.New("session expired")
+	// ErrResponseTooLarge is returned when a file served by the switch
+	// exceeds MaxResponseSize.
+	ErrResponseTooLarge = errors.New("response too large")
+	// ErrScriptTimeout is returned when the otto engine runs a file for
+	// longer than a second, or beyond the caller's deadline.
+	ErrScriptTimeout = errors.New("script timeout")
+)
+
+// StatusError is returned when the switch answers with an HTTP status other
+// than 200 OK.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return ErrUnexpectedStatus.Error() + ": " + e.Status
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrUnexpectedStatus
+}
+
+// ParseError is returned when a javascript file, or the data it sets, cannot
+// be parsed.
+type ParseError struct {
+	// The file, empty if the data could not be parsed.
+	File string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.File == "" {
+		return "parse: " + e.Err.Error()
+	}
+	return "parse " + e.File + ": " + e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// SyntaxError is returned when a javascript file holds more than variables
+// with literal values.
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
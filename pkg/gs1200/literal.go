@@ -0,0 +1,292 @@
+package gs1200
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseLiterals parses a javascript file consisting of variable declarations
+// with literal values, as the switch serves its data:
+//
+//	var name = <literal>;
+//
+// Literals are strings, numbers, booleans, null, undefined and arrays of
+// literals. Strings are returned as string, integers as int64, other numbers as
+// float64 and arrays as []interface{}. Anything else, like a function call, is
+// a *SyntaxError, so no code from the switch is ever run. So are arrays nested
+// deeper than maxDepth.
+func ParseLiterals(js string) (map[string]interface{}, error) {
+	p := &literalParser{src: js, line: 1}
+	vars := map[string]interface{}{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return vars, nil
+		}
+		if p.peek() == ';' {
+			p.pos++
+			continue
+		}
+		if word := p.identifier(); word != "var" {
+			return nil, p.errorf("expected var, found %q", word)
+		}
+		p.skipSpace()
+		name := p.identifier()
+		if name == "" {
+			return nil, p.errorf("expected a variable name")
+		}
+		p.skipSpace()
+		if p.peek() != '=' {
+			return nil, p.errorf("expected = after %s", name)
+		}
+		p.pos++
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		vars[name] = value
+	}
+}
+
+// maxDepth is how deep arrays may be nested. The switch nests them two deep.
+const maxDepth = 8
+
+type literalParser struct {
+	src  string
+	pos  int
+	line int
+	// Number of arrays being parsed.
+	depth int
+}
+
+func (p *literalParser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Line: p.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *literalParser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+// skipSpace skips white space and comments.
+func (p *literalParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "//"):
+			end := strings.IndexByte(p.src[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.src)
+			} else {
+				p.pos += end
+			}
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			end := strings.Index(p.src[p.pos+2:], "*/")
+			if end < 0 {
+				p.pos = len(p.src)
+			} else {
+				p.line += strings.Count(p.src[p.pos:p.pos+2+end], "\n")
+				p.pos += end + 4
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isIdentifier(c byte, first bool) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		!first && c >= '0' && c <= '9'
+}
+
+func (p *literalParser) identifier() string {
+	start := p.pos
+	for p.pos < len(p.src) && isIdentifier(p.src[p.pos], p.pos == start) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *literalParser) value() (interface{}, error) {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		return p.string()
+	case c == '-' || c == '+' || c == '.' || c >= '0' && c <= '9':
+		return p.number()
+	case c == '[':
+		return p.array()
+	case isIdentifier(c, true):
+		switch word := p.identifier(); word {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null", "undefined":
+			return nil, nil
+		default:
+			return nil, p.errorf("unexpected %q", word)
+		}
+	case c == 0:
+		return nil, p.errorf("unexpected end of file")
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *literalParser) array() (interface{}, error) {
+	if p.depth == maxDepth {
+		return nil, p.errorf("arrays nested deeper than %d", maxDepth)
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	p.pos++ // [
+	array := []interface{}{}
+	for {
+		p.skipSpace()
+		switch p.peek() {
+		case ']':
+			p.pos++
+			return array, nil
+		case ',':
+			// An elision, like in [1,,2].
+			p.pos++
+			array = append(array, nil)
+			continue
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *literalParser) number() (interface{}, error) {
+	start := p.pos
+	if c := p.peek(); c == '-' || c == '+' {
+		p.pos++
+	}
+	if strings.HasPrefix(p.src[p.pos:], "0x") || strings.HasPrefix(p.src[p.pos:], "0X") {
+		p.pos += 2
+		digits := p.pos
+		for p.pos < len(p.src) && strings.IndexByte("0123456789abcdefABCDEF", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		value, err := strconv.ParseInt(p.src[digits:p.pos], 16, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.src[start:p.pos])
+		}
+		if p.src[start] == '-' {
+			value = -value
+		}
+		return value, nil
+	}
+	for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+		// A sign only belongs to the number right after an exponent.
+		if c := p.src[p.pos]; (c == '+' || c == '-') && p.pos > start && p.src[p.pos-1] != 'e' && p.src[p.pos-1] != 'E' {
+			break
+		}
+		p.pos++
+	}
+	text := p.src[start:p.pos]
+	if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return value, nil
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, p.errorf("invalid number %q", text)
+	}
+	return value, nil
+}
+
+func (p *literalParser) string() (interface{}, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		case c == '\n':
+			return nil, p.errorf("unterminated string")
+		case c == '\\':
+			if err := p.escape(&b); err != nil {
+				return nil, err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *literalParser) escape(b *strings.Builder) error {
+	p.pos++ // backslash
+	if p.pos >= len(p.src) {
+		return p.errorf("unterminated string")
+	}
+	c := p.src[p.pos]
+	p.pos++
+	switch c {
+	case 'n':
+		b.WriteByte('\n')
+	case 't':
+		b.WriteByte('\t')
+	case 'r':
+		b.WriteByte('\r')
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'v':
+		b.WriteByte('\v')
+	case '0':
+		b.WriteByte(0)
+	case 'x', 'u':
+		size := 2
+		if c == 'u' {
+			size = 4
+		}
+		if p.pos+size > len(p.src) {
+			return p.errorf("invalid escape")
+		}
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+		if err != nil {
+			return p.errorf("invalid escape")
+		}
+		p.pos += size
+		b.WriteRune(rune(code))
+	case '\n':
+		// A line continuation.
+		p.line++
+	default:
+		// Anything else stands for itself, like \' and \\.
+		p.pos--
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		b.WriteRune(r)
+		p.pos += size
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package gs1200
+
+import (
+	"errors"
+	"io/fs"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/robinelfrink/gs1200-exporter/internal/samples"
+)
+
+func TestParseLiterals(t *testing.T) {
+	tests := []struct {
+		name string
+		js   string
+		want map[string]interface{}
+		err  bool
+	}{
+		{
+			name: "scalars",
+			js:   "var a = 'one';\nvar b = \"two\"; var c = 3\nvar d = -1.5; var e = 0x1F; var f = true; var g = null;",
+			want: map[string]interface{}{
+				"a": "one", "b": "two", "c": int64(3), "d": -1.5, "e": int64(31), "f": true, "g": nil,
+			},
+		},
+		{
+			name: "arrays",
+			js:   "var a = [['1','2'],[3, 4.5,],[]];\nvar b = [1,,2];",
+			want: map[string]interface{}{
+				"a": []interface{}{
+					[]interface{}{"1", "2"},
+					[]interface{}{int64(3), 4.5},
+					[]interface{}{},
+				},
+				"b": []interface{}{int64(1), nil, int64(2)},
+			},
+		},
+		{
+			name: "comments and escapes",
+			js:   "// data\n/* more\ndata */ var a = 'it\\'s \\x41\\u0042';",
+			want: map[string]interface{}{"a": "it's AB"},
+		},
+		{
+			name: "function call",
+			js:   "var a = alert('hello');",
+			err:  true,
+		},
+		{
+			name: "statement",
+			js:   "while (true) {}",
+			err:  true,
+		},
+		{
+			name: "unterminated string",
+			js:   "var a = 'one;",
+			err:  true,
+		},
+		{
+			name: "unterminated array",
+			js:   "var a = [1, 2",
+			err:  true,
+		},
+		{
+			name: "nested deeply",
+			js:   "var a = " + strings.Repeat("[", MaxResponseSize),
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLiterals(tt.js)
+			if tt.err {
+				var syntaxError *SyntaxError
+				if !errors.As(err, &syntaxError) {
+					t.Errorf("ParseLiterals() error = %v, want a SyntaxError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ParseLiterals() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLiterals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// sampleFiles returns the javascript files of all fixtures.
+func sampleFiles() map[string]string {
+	files := map[string]string{}
+	_ = fs.WalkDir(samples.FS, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			js, _ := samples.FS.ReadFile(path)
+			files[path] = string(js)
+		}
+		return err
+	})
+	return files
+}
+
+// The engines must read the same values from every fixture.
+func TestEngines_Fixtures(t *testing.T) {
+	for path, js := range sampleFiles() {
+		t.Run(path, func(t *testing.T) {
+			vars, err := ParseLiterals(js)
+			if err != nil {
+				t.Fatalf("ParseLiterals() error = %v", err)
+			}
+			otto := newEngine(EngineOtto)
+			if err := otto.run(t.Context(), js); err != nil {
+				t.Fatalf("otto error = %v", err)
+			}
+			for name, value := range vars {
+				if got, want := toString(value), toString(otto.get(name)); got != want {
+					t.Errorf("%v = %v, otto reads %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEngines(b *testing.B) {
+	files := sampleFiles()
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		js := files[path]
+		for _, name := range []string{EngineLiteral, EngineOtto} {
+			b.Run(name+"/"+path, func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					if err := newEngine(name).run(b.Context(), js); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
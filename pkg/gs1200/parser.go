@@ -0,0 +1,79 @@
+package gs1200
+
+import (
+	"path"
+	"sync"
+)
+
+// Variables are the javascript variables set by the files a switch serves.
+// Client implements it.
+type Variables interface {
+	GetInt(name string) int
+	GetFloat(name string) float64
+	GetString(name string) string
+	GetArrayOfString(name string) []string
+	GetArrayOfArrayOfString(name string) [][]string
+	GetArrayOfArrayOfInterface(name string) [][]interface{}
+	GetArrayOfInt(name string) []int
+	GetArrayOfFloat(name string) []float64
+}
+
+// Parser reads the data of a switch from its variables. Their names and
+// layout differ between models and firmwares, so each has its own parser.
+type Parser interface {
+	// Parse reads the system and port data. Only the variables of the
+	// system page and of the given pages are set.
+	Parse(vars Variables, pages []string, capabilities *Capabilities) (*SystemData, []PortData, error)
+}
+
+type registeredParser struct {
+	model    string
+	firmware string
+	parser   Parser
+}
+
+var (
+	parsersMu sync.RWMutex
+	parsers   []registeredParser
+)
+
+// FallbackParser parses the data of switches no parser is registered for.
+var FallbackParser Parser = V2Parser{}
+
+func init() {
+	RegisterParser("GS1200-*", "V2.00(*", V2Parser{})
+}
+
+// RegisterParser registers a parser for the models and firmware versions
+// matching the patterns, in the syntax of path.Match. Parsers registered later
+// take precedence.
+func RegisterParser(model string, firmware string, parser Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers = append([]registeredParser{{model, firmware, parser}}, parsers...)
+}
+
+// ParserFor returns the parser for a model and firmware version. If none was
+// registered, it returns FallbackParser and false.
+func ParserFor(model string, firmware string) (Parser, bool) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	for _, p := range parsers {
+		modelMatch, _ := path.Match(p.model, model)
+		firmwareMatch, _ := path.Match(p.firmware, firmware)
+		if modelMatch && firmwareMatch {
+			return p.parser, true
+		}
+	}
+	return FallbackParser, false
+}
+
+// hasPage reports whether page is in pages.
+func hasPage(pages []string, page string) bool {
+	for _, p := range pages {
+		if p == page {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,289 @@
+package gs1200
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/robinelfrink/gs1200-exporter/internal/samples"
+)
+
+type testParser struct{}
+
+func (testParser) Parse(vars Variables, pages []string, capabilities *Capabilities) (*SystemData, []PortData, error) {
+	return nil, nil, errors.New("test parser")
+}
+
+func TestParserFor(t *testing.T) {
+	RegisterParser("GS1200-8HP v2", "V2.01(*", testParser{})
+	defer func() {
+		parsersMu.Lock()
+		parsers = parsers[1:]
+		parsersMu.Unlock()
+	}()
+
+	tests := []struct {
+		model    string
+		firmware string
+		want     Parser
+		ok       bool
+	}{
+		{
+			model:    "GS1200-8HP v2",
+			firmware: "V2.00(ABME.3)C0",
+			want:     V2Parser{},
+			ok:       true,
+		},
+		{
+			model:    "GS1200-8HP v2",
+			firmware: "V2.01(ABME.0)C0",
+			want:     testParser{},
+			ok:       true,
+		},
+		{
+			model:    "GS1900-8",
+			firmware: "V2.70(AAHH.3)C0",
+			want:     FallbackParser,
+			ok:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model+" "+tt.firmware, func(t *testing.T) {
+			got, ok := ParserFor(tt.model, tt.firmware)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("ParserFor() = %T, %v, want %T, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// Every fixture must be parsed, whichever parser it ends up with.
+func TestParser_Fixtures(t *testing.T) {
+	tests := map[string]struct {
+		model  string
+		ports  int
+		poe    int
+		duplex string
+		pvid   int
+	}{
+		"gs1200-8hp-v2": {
+			model:  "GS1200-8HP v2",
+			ports:  8,
+			poe:    4,
+			duplex: "Full",
+			pvid:   1,
+		},
+	}
+	for _, fixture := range samples.Fixtures() {
+		t.Run(fixture, func(t *testing.T) {
+			tt, ok := tests[fixture]
+			if !ok {
+				t.Fatalf("no expectations for fixture %v", fixture)
+			}
+			server := httptest.NewServer(samples.TestingHandler(fixture))
+			// Close the server when test finishes
+			defer server.Close()
+
+			c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+			s, p, err := c.Collect(t.Context(), nil)
+			if err != nil {
+				t.Fatalf("Client.Collect() error = %v", err)
+			}
+			if s.Model != tt.model || len(p) != tt.ports || s.PoEPorts != tt.poe {
+				t.Errorf("Client.Collect() = %v with %d ports and %d PoE ports, want %v, %d and %d",
+					s.Model, len(p), s.PoEPorts, tt.model, tt.ports, tt.poe)
+			}
+			if p[0].Duplex != tt.duplex || p[2].PVID != tt.pvid {
+				t.Errorf("Client.Collect() port 1 duplex = %q, port 3 PVID = %d, want %q and %d",
+					p[0].Duplex, p[2].PVID, tt.duplex, tt.pvid)
+			}
+		})
+	}
+}
+
+func TestV2Parser_Malformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		old    string
+		new    string
+		ports  int
+		errors string
+	}{
+		{
+			name:   "short stats row",
+			file:   "link_data.js",
+			old:    "['65432',2529,0,0,'256','65432',3337,0,0,'256',0]",
+			new:    "['65432',2529]",
+			ports:  7,
+			errors: "Stats",
+		},
+		{
+			name:   "stats not a number",
+			file:   "link_data.js",
+			old:    "['65432',2529,0,0,'256','65432',3337,0,0,'256',0]",
+			new:    "['65432',null,0,0,'256','65432',3337,0,0,'256',0]",
+			ports:  7,
+			errors: "Stats",
+		},
+		{
+			name:   "speed not an array",
+			file:   "link_data.js",
+			old:    "var speed = [",
+			new:    "var speed = 'fast'; var unused = [",
+			ports:  8,
+			errors: "speed speed speed speed speed speed speed speed",
+		},
+		{
+			name:   "speed without unit",
+			file:   "link_data.js",
+			old:    "'100 Mbps Full'",
+			new:    "'100'",
+			ports:  8,
+			errors: "speed",
+		},
+		{
+			name:   "speed not a number",
+			file:   "link_data.js",
+			old:    "'100 Mbps Full'",
+			new:    "'fast Mbps Full'",
+			ports:  8,
+			errors: "speed",
+		},
+		{
+			name:   "missing power budget",
+			file:   "poe_data.js",
+			old:    "var total_power = 60;",
+			new:    "",
+			ports:  8,
+			errors: "total_power",
+		},
+		{
+			name:   "power draw not a number",
+			file:   "poe_data.js",
+			old:    "var total_real_power = 16.8;",
+			new:    "var total_real_power = 'lots';",
+			ports:  8,
+			errors: "total_real_power",
+		},
+		{
+			name:   "speed without duplex",
+			file:   "link_data.js",
+			old:    "'1000 Mbps Full'",
+			new:    "'1000 Mbps'",
+			ports:  8,
+			errors: "",
+		},
+		{
+			name:   "more ports than data",
+			file:   "system_data.js",
+			old:    "var Max_port = '8';",
+			new:    "var Max_port = '9';",
+			ports:  8,
+			errors: "portstatus",
+		},
+		{
+			name:   "dhcp state unknown",
+			file:   "system_data.js",
+			old:    "var sys_dhcp_state = '0';",
+			new:    "var sys_dhcp_state = 'maybe';",
+			ports:  8,
+			errors: "sys_dhcp_state",
+		},
+		{
+			name:   "uptime not a number",
+			file:   "system_data.js",
+			old:    "var system_uptime = '238';",
+			new:    "var system_uptime = '3 days';",
+			ports:  8,
+			errors: "system_uptime",
+		},
+		{
+			name:   "missing uptime",
+			file:   "system_data.js",
+			old:    "var system_uptime = '238';",
+			new:    "",
+			ports:  8,
+			errors: "system_uptime",
+		},
+		{
+			name:   "trunk mask not a number",
+			file:   "system_data.js",
+			old:    "var isTrunk1 = 0;",
+			new:    "var isTrunk1 = 'T2';",
+			ports:  8,
+			errors: "isTrunk1",
+		},
+		{
+			name:   "no ports",
+			file:   "system_data.js",
+			old:    "var Max_port = '8';",
+			new:    "",
+			ports:  0,
+			errors: "Max_port",
+		},
+		{
+			name:   "bad vlan mask",
+			file:   "VLAN_1Q_List_data.js",
+			old:    "'0xFF','0xFF'",
+			new:    "'0xFF','all'",
+			ports:  8,
+			errors: "qvlans",
+		},
+		{
+			name:   "missing loop status",
+			file:   "system_data.js",
+			old:    "var loop_status",
+			new:    "var unused",
+			ports:  8,
+			errors: "loop_status loop_status loop_status loop_status loop_status loop_status loop_status loop_status",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(samples.Rewrite(samples.Default, tt.file, tt.old, tt.new))
+			// Close the server when test finishes
+			defer server.Close()
+
+			c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+			s, p, err := c.Collect(t.Context(), nil)
+			if err != nil {
+				t.Fatalf("Client.Collect() error = %v", err)
+			}
+			if len(p) != tt.ports {
+				t.Errorf("Client.Collect() = %d ports, want %d", len(p), tt.ports)
+			}
+			if got := strings.Join(s.ParseErrors, " "); got != tt.errors {
+				t.Errorf("Client.Collect() parse errors = %v, want %v", got, tt.errors)
+			}
+		})
+	}
+}
+
+type panicParser struct{}
+
+func (panicParser) Parse(vars Variables, pages []string, capabilities *Capabilities) (*SystemData, []PortData, error) {
+	var ports []string
+	return nil, nil, errors.New(ports[1])
+}
+
+func TestClient_ParserPanic(t *testing.T) {
+	RegisterParser("GS1200-8HP v2", "*", panicParser{})
+	defer func() {
+		parsersMu.Lock()
+		parsers = parsers[1:]
+		parsersMu.Unlock()
+	}()
+	server := httptest.NewServer(samples.TestingHandler(samples.Default))
+	// Close the server when test finishes
+	defer server.Close()
+
+	c, _ := NewClient(strings.Replace(server.URL, "http://", "", 1), "OFcVQl1shaUM")
+	trace := &Trace{}
+	_, _, err := c.Collect(t.Context(), trace)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || trace.FailedPhase != PhaseParse {
+		t.Errorf("Client.Collect() error = %v in %v, want a ParseError in %v", err, trace.FailedPhase, PhaseParse)
+	}
+}
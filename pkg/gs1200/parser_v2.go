@@ -0,0 +1,325 @@
+package gs1200
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// V2Parser parses the data of V2.00 firmwares, as served by the GS1200-5,
+// GS1200-8 and their PoE siblings. Fields that do not hold what is expected
+// are left out, and reported in SystemData.ParseErrors.
+type V2Parser struct{}
+
+func (V2Parser) Parse(vars Variables, pages []string, capabilities *Capabilities) (*SystemData, []PortData, error) {
+	var portstatus []string
+	var speed []string
+	var stats [][]interface{}
+	var vlans [][]string
+	var pvids []int
+	var port_power = []float64{}
+
+	systemData := SystemData{
+		MaxPort:  vars.GetInt("Max_port"),
+		Model:    vars.GetString("model_name"),
+		Firmware: vars.GetString("sys_fmw_ver"),
+		IP:       vars.GetString("sys_IP"),
+		MAC:      vars.GetString("sys_MAC"),
+		Loop:     vars.GetString("loop"),
+	}
+	fail := func(field string) {
+		systemData.ParseErrors = append(systemData.ParseErrors, field)
+	}
+	if systemData.MaxPort <= 0 {
+		fail("Max_port")
+	}
+	if uptime, err := strconv.Atoi(vars.GetString("system_uptime")); err == nil && uptime >= 0 {
+		systemData.Uptime = time.Duration(uptime) * time.Second
+	} else {
+		fail("system_uptime")
+	}
+	if buildDate, err := time.Parse("2006.01.02", vars.GetString("sys_bld_date")); err == nil {
+		systemData.BuildDate = buildDate
+	} else {
+		fail("sys_bld_date")
+	}
+	systemData.Settings = Settings{
+		DeviceName: vars.GetString("sys_dev_name"),
+		SubnetMask: vars.GetString("sys_sbnt_msk"),
+		Gateway:    vars.GetString("sys_gateway"),
+		DHCP:       flagValue(vars, "sys_dhcp_state", fail),
+		EEE:        flagValue(vars, "sys_eee_state", fail),
+		FirstLogin: flagValue(vars, "sys_first_login", fail),
+	}
+	if led, err := strconv.Atoi(vars.GetString("sys_led_state")); err == nil {
+		systemData.Settings.LED = &led
+	} else {
+		fail("sys_led_state")
+	}
+	loop_status := vars.GetArrayOfString("loop_status")
+	if hasPage(pages, PageLink) {
+		portstatus = vars.GetArrayOfString("portstatus")
+		speed = vars.GetArrayOfString("speed")
+		stats = vars.GetArrayOfArrayOfInterface("Stats")
+	}
+	if hasPage(pages, PageVLAN) {
+		vlans = vars.GetArrayOfArrayOfString("qvlans")
+		if vlans == nil {
+			fail("qvlans")
+		}
+		pvids = vars.GetArrayOfInt("pvids")
+		if pvids == nil {
+			fail("pvids")
+		}
+	}
+	if hasPage(pages, PagePoE) {
+		systemData.PoE = true
+		systemData.PoEPorts = capabilities.PoEPorts
+		systemData.TotalPower = intValue(vars, "total_power", fail)
+		systemData.MaxLEDPower = intValue(vars, "max_led_power", fail)
+		if power, err := strconv.ParseFloat(vars.GetString("total_real_power"), 64); err == nil {
+			systemData.RealPower = &power
+		} else {
+			fail("total_real_power")
+		}
+		port_power = vars.GetArrayOfFloat("port_power")
+		if len(port_power) < systemData.PoEPorts {
+			fail("port_power")
+		}
+	}
+
+	// Report number of configured vlans, skipping the ones that are not
+	// "[id, members, tagged]".
+	type vlanMasks struct {
+		id              string
+		members, tagged int64
+	}
+	masks := []vlanMasks{}
+	for _, vlan := range vlans {
+		if len(vlan) < 3 {
+			fail("qvlans")
+			continue
+		}
+		members, err1 := strconv.ParseInt(strings.ReplaceAll(vlan[1], "0x", ""), 16, 64)
+		tagged, err2 := strconv.ParseInt(strings.ReplaceAll(vlan[2], "0x", ""), 16, 64)
+		if err1 != nil || err2 != nil {
+			fail("qvlans")
+			continue
+		}
+		systemData.VLANs = append(systemData.VLANs, vlan[0])
+		masks = append(masks, vlanMasks{vlan[0], members, tagged})
+	}
+
+	// The trunk groups' members are port masks, 0 if the group is unused.
+	// isTrunkGroupOne and isTrunkGroupTwo on the VLAN page only repeat
+	// whether the groups are in use.
+	for i, field := range []string{"isTrunk0", "isTrunk1"} {
+		mask, ok := maskValue(vars, field)
+		if !ok {
+			fail(field)
+			continue
+		}
+		if mask == 0 {
+			continue
+		}
+		trunk := Trunk{Name: "trunk " + strconv.Itoa(i+1)}
+		for port := 0; port < systemData.MaxPort; port++ {
+			if (mask>>port)&1 > 0 {
+				trunk.Ports = append(trunk.Ports, "port "+strconv.Itoa(port+1))
+			}
+		}
+		systemData.Trunks = append(systemData.Trunks, trunk)
+	}
+
+	// Port data is only available with the link page.
+	if !hasPage(pages, PageLink) {
+		return &systemData, []PortData{}, nil
+	}
+
+	// Ports without status or traffic are skipped.
+	if portstatus == nil {
+		fail("portstatus")
+	}
+	if stats == nil {
+		fail("Stats")
+	}
+
+	// Loop over ports
+	portData := []PortData{}
+	for i := 0; i < systemData.MaxPort; i++ {
+		port := PortData{
+			Name: "port " + strconv.Itoa(i+1),
+		}
+		if i >= len(portstatus) {
+			if portstatus != nil {
+				fail("portstatus")
+			}
+			continue
+		}
+		port.Status = portstatus[i]
+		if i < len(loop_status) {
+			port.LoopStatus = loop_status[i]
+		} else {
+			fail("loop_status")
+		}
+		port.PVLAN = "0"
+		// Loop over configured vlans.
+		for _, vlan := range masks {
+			if (vlan.members>>(i))&1 > 0 {
+				// Current vlan is connected to current port.
+				if (vlan.tagged>>(i))&1 > 0 {
+					// Tagged
+					port.VLANs = append(port.VLANs, vlan.id)
+				} else {
+					// Untagged
+					port.PVLAN = vlan.id
+					port.UntaggedVLANs = append(port.UntaggedVLANs, vlan.id)
+				}
+			}
+		}
+		if i < len(pvids) {
+			port.PVID = pvids[i]
+		} else if pvids != nil {
+			fail("pvids")
+		}
+
+		// Port speed seems to always be "[num] [unit] [duplex]". Older versions
+		// did not show duplex status.
+		var speedInfo []string
+		if i < len(speed) {
+			speedInfo = strings.Fields(speed[i])
+		}
+		if len(speedInfo) >= 2 {
+			if speed, err := strconv.Atoi(speedInfo[0]); err == nil {
+				port.Speed = speed
+			} else {
+				fail("speed")
+			}
+			port.SpeedUnit = speedInfo[1]
+			if len(speedInfo) > 2 {
+				port.Duplex = speedInfo[2]
+			} else {
+				port.Duplex = ""
+			}
+		} else {
+			fail("speed")
+		}
+
+		// Sent/received traffic has a weird structure. This is what Zyxel's
+		// code does:
+		//
+		//   tx = Stats[k][1]+Stats[k][2]+Stats[k][3];
+		//   rx = Stats[k][6]+Stats[k][7]+Stats[k][8]+Stats[k][10];
+		//   tx = parseFloat(tx).toLocaleString(); //Divide the numbers with commas
+		//   rx = parseFloat(rx).toLocaleString();
+		if i >= len(stats) {
+			if stats != nil {
+				fail("Stats")
+			}
+			continue
+		}
+		row, ok := statsRow(stats[i])
+		if !ok {
+			fail("Stats")
+			continue
+		}
+		tx := PortCounters{
+			Unicast:   row[1],
+			Multicast: row[2],
+			Broadcast: row[3],
+		}
+		rx := PortCounters{
+			Unicast:   row[6],
+			Multicast: row[7],
+			Broadcast: row[8],
+		}
+		port.Stats.TXCounters, port.Stats.RXCounters = tx, rx
+		port.Stats.TX = tx.Unicast + tx.Multicast + tx.Broadcast
+		port.Stats.RX = rx.Unicast + rx.Multicast + rx.Broadcast + row[10]
+		port.Stats.Columns = make(map[int]float64, len(unknownColumns))
+		for _, column := range unknownColumns {
+			port.Stats.Columns[column] = row[column]
+		}
+
+		// PoE data
+		if i < systemData.PoEPorts && i < len(port_power) {
+			port.Stats.Power = port_power[i]
+		}
+
+		portData = append(portData, port)
+	}
+
+	return &systemData, portData, nil
+}
+
+// unknownColumns are the columns of a Stats row whose meaning is not known.
+var unknownColumns = []int{0, 4, 5, 9, 10}
+
+// statsRow converts a row of the Stats array, which must have 11 numeric
+// columns.
+func statsRow(row []interface{}) ([11]float64, bool) {
+	var result [11]float64
+	if len(row) < len(result) {
+		return result, false
+	}
+	for i := range result {
+		value, ok := numberValue(row[i])
+		if !ok {
+			return result, false
+		}
+		result[i] = value
+	}
+	return result, true
+}
+
+// maskValue returns a port mask, served as a number or as a hexadecimal
+// string like the VLAN masks.
+func maskValue(vars Variables, field string) (int64, bool) {
+	value := vars.GetString(field)
+	if hex, ok := strings.CutPrefix(value, "0x"); ok {
+		mask, err := strconv.ParseInt(hex, 16, 64)
+		return mask, err == nil
+	}
+	mask, err := strconv.ParseInt(value, 10, 64)
+	return mask, err == nil
+}
+
+// intValue returns a variable holding an integer, or nil after calling fail.
+func intValue(vars Variables, field string, fail func(string)) *int {
+	value, err := strconv.Atoi(vars.GetString(field))
+	if err != nil {
+		fail(field)
+		return nil
+	}
+	return &value
+}
+
+// flagValue returns a variable that is either "0" or "1", or nil after
+// calling fail.
+func flagValue(vars Variables, field string, fail func(string)) *bool {
+	var flag bool
+	switch vars.GetString(field) {
+	case "0":
+	case "1":
+		flag = true
+	default:
+		fail(field)
+		return nil
+	}
+	return &flag
+}
+
+// numberValue converts an element of a javascript array, which may be a
+// number or a numeric string.
+func numberValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
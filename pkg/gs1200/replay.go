@@ -0,0 +1,60 @@
+package gs1200
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// NewReplayClient returns a client reading the javascript files in files
+// instead of a switch, to replay data captured from one. Logging in always
+// succeeds, and the pages whose files are missing are not collected. The
+// address only names the switch.
+func NewReplayClient(address string, files fs.FS) (*Client, error) {
+	client, err := NewClient(address, "")
+	if err != nil {
+		return nil, err
+	}
+	client.client.Transport = &replayTransport{files: files}
+	return client, nil
+}
+
+// replayTransport answers requests for the switch from files.
+type replayTransport struct {
+	files fs.FS
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	status, body := http.StatusOK, []byte{}
+	switch name := strings.TrimPrefix(req.URL.Path, "/"); {
+	case name == "login.cgi" || name == "logout.html":
+	case strings.Contains(name, "/") || !fs.ValidPath(name):
+		status = http.StatusNotFound
+	default:
+		data, err := fs.ReadFile(t.files, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			status = http.StatusNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
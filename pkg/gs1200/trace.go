@@ -0,0 +1,58 @@
+package gs1200
+
+import (
+	"time"
+)
+
+// Phases of a scrape.
+const (
+	PhaseLogin    = "login"
+	PhaseDiscover = "discover"
+	PhaseFetch    = "fetch"
+	PhaseParse    = "parse"
+	PhaseLogout   = "logout"
+)
+
+// Trace records the phases of a single call of Client.Collect.
+type Trace struct {
+	Phases   []Phase
+	Duration time.Duration
+	// Number of times somebody else was logged in.
+	Conflicts int
+	// The phase that failed and its error, if any.
+	FailedPhase string
+	Err         error
+
+	start time.Time
+}
+
+type Phase struct {
+	Name string
+	// The javascript file for discover, fetch and parse phases.
+	File     string
+	Duration time.Duration
+}
+
+func (t *Trace) begin() {
+	t.start = time.Now()
+}
+
+func (t *Trace) end() {
+	t.Duration = time.Since(t.start)
+}
+
+// observe records a phase that started at start and has just ended.
+func (t *Trace) observe(name string, file string, start time.Time) {
+	t.Phases = append(t.Phases, Phase{
+		Name:     name,
+		File:     file,
+		Duration: time.Since(start),
+	})
+}
+
+// fail records the failed phase, and returns its error.
+func (t *Trace) fail(phase string, err error) error {
+	t.FailedPhase = phase
+	t.Err = err
+	return err
+}